@@ -0,0 +1,60 @@
+package client
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+// 发送Option之后读取握手结果，回应服务端的challenge直到收到结果，cred可以为空
+// 服务端在认证通过后可能马上发来消息(例如双向连接上的调用)，
+// json解码器多读的数据要先交给编码器，返回的连接包含这部分数据
+func authenticate(conn net.Conn, cred *diyrpc.Credentials) (net.Conn, error) {
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var msg diyrpc.AuthMessage
+		if err := dec.Decode(&msg); err != nil {
+			return nil, irpc.NewError(irpc.CodeUnavailable, "[Client] read authentication result: "+err.Error())
+		}
+		if msg.Done {
+			if msg.Error != "" {
+				return nil, irpc.NewError(msg.Code, msg.Error)
+			}
+			break
+		}
+		if cred == nil || cred.Respond == nil {
+			return nil, irpc.NewError(irpc.CodeUnauthenticated, "[Client] server sent a challenge but credentials can't respond")
+		}
+		resp, err := cred.Respond(msg.Challenge)
+		if err != nil {
+			return nil, irpc.NewError(irpc.CodeUnauthenticated, "[Client] respond to challenge: "+err.Error())
+		}
+		if err := enc.Encode(&diyrpc.AuthMessage{Response: resp}); err != nil {
+			return nil, irpc.NewError(irpc.CodeUnavailable, err.Error())
+		}
+	}
+	// 服务端可能暂时不发消息，不能在这里等待换行符，第一次读取时再跳过
+	return &bufferedConn{Reader: bufio.NewReader(io.MultiReader(dec.Buffered(), conn)), Conn: conn}, nil
+}
+
+// 读取时先读json解码器缓冲的数据，再读连接
+// json.Encoder会在认证结果后面写一个换行符，第一次读取时跳过
+type bufferedConn struct {
+	*bufio.Reader
+	net.Conn
+	skipped bool
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	if !c.skipped {
+		c.skipped = true
+		if b, err := c.Reader.Peek(1); err == nil && b[0] == '\n' {
+			_, _ = c.Reader.Discard(1)
+		}
+	}
+	return c.Reader.Read(p)
+}
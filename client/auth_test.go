@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Whoami struct{}
+
+func (w *Whoami) Me(ctx context.Context, args struct{}, reply *string) error {
+	if id := diyrpc.IdentityFromContext(ctx); id != nil {
+		*reply = id.Scheme + ":" + id.Subject
+	}
+	return nil
+}
+
+func (w *Whoami) Cert(ctx context.Context, args struct{}, reply *string) error {
+	if id := diyrpc.IdentityFromContext(ctx); id != nil && id.Certificate != nil {
+		*reply = id.Certificate.Subject.CommonName
+	}
+	return nil
+}
+
+func startAuthServer(t *testing.T, a diyrpc.Authenticator) (s *diyrpc.Server, addr string) {
+	addr = newTestServer(t, func(srv *diyrpc.Server) {
+		s = srv
+		s.SetAuthenticator(a)
+	}, new(Whoami))
+	return s, addr
+}
+
+func TestAuthentication(t *testing.T) {
+	secret := []byte("shared secret")
+	_, tokenAddr := startAuthServer(t, &diyrpc.TokenAuthenticator{Tokens: map[string]string{"t0ken": "alice"}})
+	_, hmacAddr := startAuthServer(t, &diyrpc.HMACAuthenticator{Secrets: map[string][]byte{"k1": secret}})
+
+	me := func(t *testing.T, c *Client) string {
+		var reply string
+		if err := c.Call(context.Background(), "Whoami.Me", struct{}{}, &reply); err != nil {
+			t.Fatal(err)
+		}
+		return reply
+	}
+
+	t.Run("bearer", func(t *testing.T) {
+		c, err := Dial("tcp", tokenAddr, &diyrpc.Option{Credentials: diyrpc.BearerCredentials("t0ken")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if got := me(t, c); got != "bearer:alice" {
+			t.Fatalf("identity %q", got)
+		}
+	})
+	t.Run("bad token", func(t *testing.T) {
+		_, err := Dial("tcp", tokenAddr, &diyrpc.Option{Credentials: diyrpc.BearerCredentials("wrong")})
+		if irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect Unauthenticated, got %v", err)
+		}
+	})
+	t.Run("hmac", func(t *testing.T) {
+		c, err := Dial("tcp", hmacAddr, &diyrpc.Option{Credentials: diyrpc.HMACCredentials("k1", secret)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if got := me(t, c); got != "hmac:k1" {
+			t.Fatalf("identity %q", got)
+		}
+	})
+	t.Run("bad secret", func(t *testing.T) {
+		_, err := Dial("tcp", hmacAddr, &diyrpc.Option{Credentials: diyrpc.HMACCredentials("k1", []byte("guess"))})
+		if irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect Unauthenticated, got %v", err)
+		}
+	})
+	t.Run("wrong scheme", func(t *testing.T) {
+		_, err := Dial("tcp", hmacAddr, &diyrpc.Option{Credentials: diyrpc.BearerCredentials("t0ken")})
+		if irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect Unauthenticated, got %v", err)
+		}
+	})
+	t.Run("no credentials", func(t *testing.T) {
+		_, err := Dial("tcp", tokenAddr)
+		if irpc.CodeOf(err) != irpc.CodeUnauthenticated || !strings.Contains(err.Error(), "bearer token required") {
+			t.Fatalf("expect Unauthenticated from the server, got %v", err)
+		}
+	})
+	t.Run("peer identity", func(t *testing.T) {
+		s, addr := startAuthServer(t, &diyrpc.TokenAuthenticator{Tokens: map[string]string{"t0ken": "bob"}})
+		got := make(chan *diyrpc.Identity, 1)
+		s.OnPeer(func(p *diyrpc.Peer) { got <- p.Identity() })
+		c, err := DialBidirectional("tcp", addr, nil, &diyrpc.Option{Credentials: diyrpc.BearerCredentials("t0ken")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if id := <-got; id == nil || id.Subject != "bob" {
+			t.Fatalf("peer identity %+v", id)
+		}
+	})
+}
+
+// 服务端的配置可以在处理连接时替换，在-race下检查没有数据竞争
+func TestServer_ReconfigureWhileServing(t *testing.T) {
+	var s *diyrpc.Server
+	addr := newTestServer(t, func(srv *diyrpc.Server) { s = srv }, new(Whoami))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 10; i++ {
+			c, err := DialBidirectional("tcp", addr, nil)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			var me string
+			_ = c.Call(context.Background(), "Whoami.Me", struct{}{}, &me)
+			_ = c.Close()
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		s.SetAuthenticator(nil)
+		s.SetTLSConfig(nil)
+		s.SetIdleTimeout(time.Minute)
+		s.SetLimits(&code.Limits{MaxBodySize: 1 << 20})
+		s.OnPeer(func(p *diyrpc.Peer) {})
+	}
+}
+
+// 不读取握手结果的旧客户端发送Option后直接使用gob，服务端不能在中间插入握手结果
+func TestHandshake_LegacyClient(t *testing.T) {
+	legacy := func(t *testing.T, addr string) (*irpc.Header, string) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = conn.Close() }()
+		_ = conn.SetDeadline(time.Now().Add(2 * time.Second))
+		if err := json.NewEncoder(conn).Encode(&diyrpc.Option{MarkedDiyrpc: diyrpc.MarkDiyrpc, CodeType: irpc.GobType}); err != nil {
+			t.Fatal(err)
+		}
+		cc := code.NewGobCode(conn)
+		if err := cc.Write(&irpc.Header{ServiceMethod: "Whoami.Me", Seq: 1}, struct{}{}); err != nil {
+			t.Fatal(err)
+		}
+		var h irpc.Header
+		var me string
+		if err := cc.ReadHeader(&h); err != nil {
+			return nil, err.Error()
+		}
+		_ = cc.ReadBody(&me)
+		return &h, me
+	}
+	t.Run("no authenticator", func(t *testing.T) {
+		h, me := legacy(t, newTestServer(t, nil, new(Whoami)))
+		if h == nil || h.Error != "" || me != "" {
+			t.Fatalf("expect a plain gob response, got %+v %q", h, me)
+		}
+	})
+	t.Run("authenticator rejects without a result", func(t *testing.T) {
+		_, addr := startAuthServer(t, &diyrpc.TokenAuthenticator{Tokens: map[string]string{"t0ken": "alice"}})
+		if h, _ := legacy(t, addr); h != nil {
+			t.Fatalf("expect the connection to be closed, got %+v", h)
+		}
+	})
+}
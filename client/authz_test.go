@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Admin struct{}
+
+func (a *Admin) Reset(args int, reply *int) error {
+	*reply = args
+	return nil
+}
+
+// 策略本身的测试在diyrpc中，这里只检查授权在普通调用和批量调用中都生效
+func TestAuthorization(t *testing.T) {
+	policy, err := diyrpc.ParsePolicy([]byte(`{"rules": [
+		{"methods": ["Admin.*"], "allow": ["alice"]},
+		{"methods": ["Whoami.*"], "allow": ["*"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, addr := startAuthServer(t, &diyrpc.TokenAuthenticator{Tokens: map[string]string{"a": "alice", "b": "bob"}})
+	_ = s.Register(new(Admin))
+	s.SetAuthorizer(policy)
+	dial := func(token string) *Client {
+		c, err := Dial("tcp", addr, &diyrpc.Option{Credentials: diyrpc.BearerCredentials(token)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	}
+	alice, bob := dial("a"), dial("b")
+
+	var n int
+	if err := alice.Call(context.Background(), "Admin.Reset", 1, &n); err != nil || n != 1 {
+		t.Fatalf("alice should be allowed: %d, %v", n, err)
+	}
+	if err := bob.Call(context.Background(), "Admin.Reset", 1, &n); irpc.CodeOf(err) != irpc.CodePermissionDenied {
+		t.Fatalf("bob should be denied, got %v", err)
+	}
+	b := bob.NewBatch()
+	var me string
+	reset := b.Add("Admin.Reset", 1, &n)
+	who := b.Add("Whoami.Me", struct{}{}, &me)
+	if err := b.Do(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if irpc.CodeOf(reset.Error) != irpc.CodePermissionDenied || who.Error != nil || me != "bearer:bob" {
+		t.Fatalf("batch results: %v, %v, %q", reset.Error, who.Error, me)
+	}
+}
@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"tinyRPCFramwork/irpc"
+)
+
+// 批量调用，多个调用编码在一个请求中发出，服务端执行完后一起返回
+// 适合大量小调用的场景，省去每个调用单独编码header、flush和系统调用的开销
+// 批量调用不经过重试和熔断
+type Batch struct {
+	c *Client
+	// 服务端按添加的顺序依次执行，默认并发执行
+	Ordered bool
+	calls   []*Call
+}
+
+func (c *Client) NewBatch() *Batch {
+	return &Batch{c: c}
+}
+
+// 添加一个调用，Do返回后可以通过返回的Call得到这个调用的错误
+func (b *Batch) Add(serviceMethod string, args, reply interface{}) *Call {
+	call := &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		reply:         reply,
+		Done:          make(chan *Call, 1),
+	}
+	b.calls = append(b.calls, call)
+	return call
+}
+
+func (b *Batch) Len() int {
+	return len(b.calls)
+}
+
+// 发出所有调用并等待结果，一个Batch只能Do一次
+// 返回的错误表示整个批量失败，如连接断开或者超时，此时每个Call的Error都是这个错误；
+// 返回nil时各个调用的结果和错误在各自的Call中
+func (b *Batch) Do(ctx context.Context) error {
+	if len(b.calls) == 0 {
+		return nil
+	}
+	for _, call := range b.calls {
+		call.finish = b.c.opt.Metrics.Start(call.ServiceMethod)
+	}
+	req := &irpc.BatchRequest{
+		Calls:   make([]irpc.BatchCall, len(b.calls)),
+		Ordered: b.Ordered,
+	}
+	for i, call := range b.calls {
+		args, err := b.c.cc.EncodeValue(call.Args)
+		if err != nil {
+			return b.fail(irpc.NewError(irpc.CodeInvalidArgument, "[Client] encode batch args faild:"+err.Error()))
+		}
+		req.Calls[i] = irpc.BatchCall{ServiceMethod: call.ServiceMethod, Args: args}
+	}
+	resp := new(irpc.BatchResponse)
+	err := b.c.wait(ctx, &Call{
+		Args:  req,
+		reply: resp,
+		Done:  make(chan *Call, 1),
+		ctx:   ctx,
+		kind:  irpc.KindBatch,
+	})
+	if err != nil {
+		return b.fail(err)
+	}
+	if len(resp.Results) != len(b.calls) {
+		return b.fail(irpc.Errorf(irpc.CodeInternal, "[Client] expect %d batch results, got %d", len(b.calls), len(resp.Results)))
+	}
+	for i, call := range b.calls {
+		result := &resp.Results[i]
+		if result.Error != "" {
+			call.Error = irpc.HeaderError(&irpc.Header{Error: result.Error, Code: result.Code})
+		} else if err := b.c.cc.DecodeValue(result.Reply, call.reply); err != nil {
+			call.Error = irpc.NewError(irpc.CodeInternal, "[Client] decode batch reply faild:"+err.Error())
+		}
+		call.done()
+	}
+	return nil
+}
+
+func (b *Batch) fail(err error) error {
+	for _, call := range b.calls {
+		call.Error = err
+		call.done()
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Calc struct {
+	mu    sync.Mutex
+	order []int
+}
+
+type CalcArgs struct {
+	A, B int
+}
+
+func (c *Calc) Add(args CalcArgs, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (c *Calc) Upper(args string, reply *string) error {
+	*reply = args + "!"
+	return nil
+}
+
+func (c *Calc) Fail(args int, reply *int) error {
+	return errors.New("calc failed")
+}
+
+// 先添加的调用睡得更久，用来验证执行顺序
+func (c *Calc) Sleep(args int, reply *int) error {
+	time.Sleep(time.Duration(3-args) * time.Millisecond * 20)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order = append(c.order, args)
+	return nil
+}
+
+func TestBatch(t *testing.T) {
+	calc := new(Calc)
+	c, _ := Dial("tcp", newTestServer(t, nil, calc))
+	defer func() { _ = c.Close() }()
+
+	t.Run("results and errors", func(t *testing.T) {
+		b := c.NewBatch()
+		var sum int
+		var upper string
+		var failed int
+		addCall := b.Add("Calc.Add", CalcArgs{A: 1, B: 2}, &sum)
+		upperCall := b.Add("Calc.Upper", "hi", &upper)
+		failCall := b.Add("Calc.Fail", 0, &failed)
+		missingCall := b.Add("Calc.Missing", 0, &failed)
+		err := b.Do(context.Background())
+		_assert(err == nil, "batch failed: %v", err)
+		_assert(addCall.Error == nil && sum == 3, "expect 3, got %d %v", sum, addCall.Error)
+		_assert(upperCall.Error == nil && upper == "hi!", "expect hi!, got %q %v", upper, upperCall.Error)
+		_assert(failCall.Error != nil && failCall.Error.Error() == "calc failed", "expect calc failed, got %v", failCall.Error)
+		_assert(irpc.CodeOf(missingCall.Error) == irpc.CodeNotFound, "expect NotFound, got %v", missingCall.Error)
+	})
+	t.Run("ordered", func(t *testing.T) {
+		calc.order = nil
+		b := c.NewBatch()
+		b.Ordered = true
+		replies := make([]int, 3)
+		for i := 0; i < 3; i++ {
+			b.Add("Calc.Sleep", i, &replies[i])
+		}
+		_assert(b.Do(context.Background()) == nil, "batch failed")
+		_assert(len(calc.order) == 3 && calc.order[0] == 0 && calc.order[1] == 1 && calc.order[2] == 2,
+			"expect calls in order, got %v", calc.order)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*30)
+		defer cancel()
+		b := c.NewBatch()
+		b.Ordered = true
+		var reply int
+		call := b.Add("Calc.Sleep", 0, &reply)
+		err := b.Do(ctx)
+		_assert(irpc.CodeOf(err) == irpc.CodeDeadlineExceeded && call.Error == err, "expect DeadlineExceeded, got %v", err)
+	})
+}
+
+// 用JSON编码单个值的编码器，在包初始化时注册
+const jsonValues irpc.Type = "application/x-gob-json-values"
+
+// EncodeValue的调用次数
+var jsonValuesEncoded int32
+
+type jsonValueCode struct {
+	irpc.ICode
+}
+
+func (jc jsonValueCode) EncodeValue(v interface{}) ([]byte, error) {
+	atomic.AddInt32(&jsonValuesEncoded, 1)
+	return json.Marshal(v)
+}
+
+func (jc jsonValueCode) DecodeValue(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// 批量调用的参数和返回值使用连接协商的编码器编码
+func TestBatch_CodeType(t *testing.T) {
+	addr := newTestServer(t, nil, new(Calc))
+	atomic.StoreInt32(&jsonValuesEncoded, 0)
+	c, err := Dial("tcp", addr, &diyrpc.Option{CodeType: jsonValues})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	b := c.NewBatch()
+	var sum int
+	var upper string
+	b.Add("Calc.Add", CalcArgs{A: 1, B: 2}, &sum)
+	b.Add("Calc.Upper", "hi", &upper)
+	if err := b.Do(context.Background()); err != nil || sum != 3 || upper != "hi!" {
+		t.Fatalf("got %d %q, %v", sum, upper, err)
+	}
+	// 客户端编码两个参数，服务端编码两个返回值
+	if n := atomic.LoadInt32(&jsonValuesEncoded); n != 4 {
+		t.Fatalf("expect 4 values encoded by the negotiated codec, got %d", n)
+	}
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Bench struct{}
+
+func (b *Bench) Echo(args int, reply *int) error {
+	*reply = args
+	return nil
+}
+
+// 并发调用的吞吐，客户端和服务端使用同一种编码器
+func benchmarkCall(b *testing.B, opt *code.WriteOption) {
+	code.Init()
+	irpc.NewCodeFuncMap[irpc.GobType] = func(conn io.ReadWriteCloser) irpc.ICode {
+		return code.NewGobCodeOption(conn, opt)
+	}
+	defer code.Init()
+	s := diyrpc.NewServer()
+	_ = s.Register(new(Bench))
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var reply int
+		for pb.Next() {
+			if err := c.Call(context.Background(), "Bench.Echo", 1, &reply); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// 合并写
+func BenchmarkCall_Coalesced(b *testing.B) {
+	benchmarkCall(b, code.DefaultWriteOption)
+}
+
+// 每条消息flush一次
+func BenchmarkCall_FlushEach(b *testing.B) {
+	benchmarkCall(b, nil)
+}
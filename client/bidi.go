@@ -0,0 +1,123 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"strings"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+// 建立双向连接，services中的服务在握手前注册，
+// 服务端可以通过diyrpc.Peer在同一个连接上调用它们，适合客户端在NAT后面的情况
+// 客户端的服务只支持普通方法，不支持流方法
+func DialBidirectional(network, address string, services []interface{}, opts ...*diyrpc.Option) (*Client, error) {
+	svcs := make(map[string]*service.Service)
+	for _, rcvr := range services {
+		svc, err := service.NewService(rcvr)
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := svcs[svc.Name]; dup {
+			return nil, errors.New("[Client] service already defined:" + svc.Name)
+		}
+		svcs[svc.Name] = svc
+	}
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	opt.Bidirectional = true
+	return dialTimeout(func(conn net.Conn, opt *diyrpc.Option) (*Client, error) {
+		return newClientServices(conn, opt, svcs)
+	}, network, address, opt)
+}
+
+// 处理服务端发起的调用和取消，返回读body的错误
+func (c *Client) serveReverse(h *irpc.Header) error {
+	if h.Kind == irpc.KindCancel {
+		c.mu.Lock()
+		cancel := c.reverse[h.Seq]
+		delete(c.reverse, h.Seq)
+		c.mu.Unlock()
+		if cancel != nil {
+			cancel()
+		}
+		return c.cc.ReadBody(nil)
+	}
+	svc, mType, err := c.findService(h.ServiceMethod)
+	if err != nil {
+		if err := c.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		go c.replyReverse(h, err, nil)
+		return nil
+	}
+	argv := mType.NewArgv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if err := c.cc.ReadBody(argvi); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	if h.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), h.Timeout)
+	}
+	c.mu.Lock()
+	c.reverse[h.Seq] = cancel
+	c.mu.Unlock()
+	go func() {
+		defer cancel()
+		replyv := mType.NewReply()
+		err := svc.CallContext(ctx, mType, argv, replyv)
+		c.mu.Lock()
+		_, ok := c.reverse[h.Seq]
+		delete(c.reverse, h.Seq)
+		c.mu.Unlock()
+		// 服务端已经放弃了这个调用
+		if !ok || ctx.Err() == context.Canceled {
+			return
+		}
+		if err == nil && ctx.Err() != nil {
+			err = irpc.NewError(irpc.CodeDeadlineExceeded, "[Client] callback handle timeout")
+		}
+		c.replyReverse(h, err, replyv.Interface())
+	}()
+	return nil
+}
+
+func (c *Client) replyReverse(h *irpc.Header, err error, reply interface{}) {
+	resp := &irpc.Header{ServiceMethod: h.ServiceMethod, Seq: h.Seq, Reverse: true}
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Code = irpc.CodeOf(err)
+		reply = struct{}{}
+	}
+	if err := c.write(resp, reply); err != nil {
+		c.logger.Warn("write callback response failed", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+	}
+}
+
+func (c *Client) findService(serviceMethod string) (*service.Service, *service.MethodType, error) {
+	dot := strings.LastIndex(serviceMethod, ".")
+	if dot < 0 {
+		return nil, nil, irpc.NewError(irpc.CodeInvalidArgument, "[Client] serviceMethod 格式错误"+serviceMethod)
+	}
+	svc := c.services[serviceMethod[:dot]]
+	if svc == nil {
+		return nil, nil, irpc.NewError(irpc.CodeNotFound, "[Client] can't find service"+serviceMethod[:dot])
+	}
+	mType := svc.Method[serviceMethod[dot+1:]]
+	if mType == nil {
+		return nil, nil, irpc.NewError(irpc.CodeNotFound, "[Client] can't find method"+serviceMethod[dot+1:])
+	}
+	if mType.Streaming != service.Unary {
+		return nil, nil, irpc.NewError(irpc.CodeInvalidArgument, "[Client] streaming method can't be called back:"+serviceMethod)
+	}
+	return svc, mType, nil
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Worker struct {
+	name string
+}
+
+func (w *Worker) Name(args int, reply *string) error {
+	*reply = w.name
+	return nil
+}
+
+func (w *Worker) Wait(ctx context.Context, args int, reply *int) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+type Coordinator struct{}
+
+// 在处理请求的过程中回调发起请求的客户端
+func (c *Coordinator) Join(ctx context.Context, args int, reply *string) error {
+	peer := diyrpc.PeerFromContext(ctx)
+	if peer == nil {
+		return irpc.NewError(irpc.CodeInvalidArgument, "not a bidirectional connection")
+	}
+	return peer.Call(ctx, "Worker.Name", 0, reply)
+}
+
+func TestBidirectional(t *testing.T) {
+	peers := make(chan *diyrpc.Peer, 1)
+	addr := newTestServer(t, func(s *diyrpc.Server) {
+		s.OnPeer(func(p *diyrpc.Peer) {
+			peers <- p
+		})
+	}, new(Coordinator))
+	c, err := DialBidirectional("tcp", addr, []interface{}{&Worker{name: "worker-1"}})
+	_assert(err == nil, "dial failed: %v", err)
+	defer func() { _ = c.Close() }()
+	peer := <-peers
+
+	t.Run("server calls client", func(t *testing.T) {
+		var name string
+		err := peer.Call(context.Background(), "Worker.Name", 0, &name)
+		_assert(err == nil && name == "worker-1", "expect worker-1, got %q %v", name, err)
+	})
+	t.Run("callback during call", func(t *testing.T) {
+		var name string
+		err := c.Call(context.Background(), "Coordinator.Join", 0, &name)
+		_assert(err == nil && name == "worker-1", "expect worker-1, got %q %v", name, err)
+	})
+	t.Run("unknown method", func(t *testing.T) {
+		var reply int
+		err := peer.Call(context.Background(), "Worker.Missing", 0, &reply)
+		_assert(irpc.CodeOf(err) == irpc.CodeNotFound, "expect NotFound, got %v", err)
+	})
+	t.Run("deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*100)
+		defer cancel()
+		var reply int
+		err := peer.Call(ctx, "Worker.Wait", 0, &reply)
+		_assert(irpc.CodeOf(err) == irpc.CodeDeadlineExceeded, "expect DeadlineExceeded, got %v", err)
+	})
+	t.Run("client closed", func(t *testing.T) {
+		_ = c.Close()
+		select {
+		case <-peer.Done():
+		case <-time.After(time.Second):
+			t.Fatal("expect the peer to be closed")
+		}
+		var name string
+		err := peer.Call(context.Background(), "Worker.Name", 0, &name)
+		_assert(err != nil && strings.Contains(err.Error(), "closed"), "expect peer closed, got %v", err)
+	})
+}
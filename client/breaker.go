@@ -0,0 +1,286 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 熔断器的状态
+type BreakerState int32
+
+const (
+	// 正常放行请求
+	StateClosed BreakerState = iota
+	// 直接拒绝请求
+	StateOpen
+	// 放行少量探测请求，根据结果决定关闭还是重新打开
+	StateHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("BreakerState(%d)", int32(s))
+}
+
+type BreakerConfig struct {
+	// 连续失败多少次后打开，0表示不按连续失败打开
+	ConsecutiveFailures int
+	// 窗口内错误率达到多少后打开，取值(0,1]，0表示不按错误率打开
+	ErrorRate float64
+	// 窗口内请求数少于MinRequests时不计算错误率
+	MinRequests int
+	// 统计错误率的时间窗口
+	Window time.Duration
+	// 打开多久之后进入半开状态
+	OpenTimeout time.Duration
+	// 半开状态最多同时放行的探测请求数
+	HalfOpenMaxProbes int
+	// 哪些错误码算作失败，为空时使用DefaultBreakerConfig.FailureCodes
+	FailureCodes []irpc.Code
+	// 状态变化时回调，在锁外调用
+	OnStateChange func(name string, from, to BreakerState)
+}
+
+var DefaultBreakerConfig = &BreakerConfig{
+	ConsecutiveFailures: 5,
+	ErrorRate:           0.5,
+	MinRequests:         20,
+	Window:              time.Second * 10,
+	OpenTimeout:         time.Second * 5,
+	HalfOpenMaxProbes:   1,
+	FailureCodes: []irpc.Code{
+		irpc.CodeUnavailable,
+		irpc.CodeDeadlineExceeded,
+		irpc.CodeResourceExhausted,
+		irpc.CodeInternal,
+	},
+}
+
+// 熔断器的统计信息
+type BreakerMetrics struct {
+	State    BreakerState
+	Requests uint64
+	Failures uint64
+	// 因为熔断被拒绝的请求数
+	Rejected uint64
+	// 进入打开状态的次数
+	Opened uint64
+}
+
+// 一个后端实例的熔断器
+type Breaker struct {
+	name string
+	cfg  *BreakerConfig
+	mu   sync.Mutex
+
+	state       BreakerState
+	openedAt    time.Time
+	consecutive int
+	// 当前窗口的起点和计数
+	windowStart    time.Time
+	windowRequests int
+	windowFailures int
+	// 半开状态下正在进行的探测请求数
+	probes int
+	// 每次状态变化加一，请求结束时用它判断放行时的状态是否已经过去
+	generation uint64
+
+	metrics BreakerMetrics
+}
+
+var ErrBreakerOpen = irpc.NewError(irpc.CodeUnavailable, "[Client] circuit breaker is open")
+
+func NewBreaker(name string, cfg *BreakerConfig) *Breaker {
+	if cfg == nil {
+		cfg = DefaultBreakerConfig
+	}
+	return &Breaker{
+		name:        name,
+		cfg:         cfg,
+		windowStart: time.Now(),
+	}
+}
+
+func (b *Breaker) Name() string {
+	return b.name
+}
+
+// 请求前调用，熔断器打开时返回ErrBreakerOpen
+// 返回nil时，请求结束后必须用请求的结果调用一次done
+// ctx是调用方的ctx，请求结束时ctx已经结束的话，错误是调用方造成的，结果不计入统计
+func (b *Breaker) Allow(ctx context.Context) (done func(err error), err error) {
+	if b == nil {
+		return func(error) {}, nil
+	}
+	b.mu.Lock()
+	from := b.state
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setState(StateHalfOpen)
+	}
+	switch b.state {
+	case StateOpen:
+		err = ErrBreakerOpen
+	case StateHalfOpen:
+		if b.probes >= b.maxProbes() {
+			err = ErrBreakerOpen
+		} else {
+			b.probes++
+		}
+	}
+	if err != nil {
+		b.metrics.Rejected++
+	} else {
+		b.metrics.Requests++
+	}
+	// 放行时的状态，探测请求只在它所属的半开状态中生效
+	probe, generation := b.state == StateHalfOpen, b.generation
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return func(err error) {
+		b.done(probe, generation, err, ctx != nil && ctx.Err() != nil)
+	}, nil
+}
+
+// ignored为true时只释放探测名额，不改变状态
+func (b *Breaker) done(probe bool, generation uint64, err error, ignored bool) {
+	failed := !ignored && b.isFailure(err)
+	b.mu.Lock()
+	from := b.state
+	if failed {
+		b.metrics.Failures++
+	}
+	switch {
+	case generation != b.generation:
+		// 放行之后状态已经变化，例如关闭时放行的请求在半开时才结束，不影响当前状态
+	case probe:
+		b.probes--
+		if failed {
+			b.setState(StateOpen)
+		} else if !ignored {
+			b.setState(StateClosed)
+		}
+	case !ignored:
+		now := time.Now()
+		if b.cfg.Window > 0 && now.Sub(b.windowStart) >= b.cfg.Window {
+			b.windowStart = now
+			b.windowRequests, b.windowFailures = 0, 0
+		}
+		b.windowRequests++
+		if failed {
+			b.windowFailures++
+			b.consecutive++
+		} else {
+			b.consecutive = 0
+		}
+		if b.shouldOpen() {
+			b.setState(StateOpen)
+		}
+	}
+	to := b.state
+	b.mu.Unlock()
+	b.notify(from, to)
+}
+
+func (b *Breaker) State() BreakerState {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// 现在调用Allow是否可能放行，不改变状态，用于选择实例时跳过打开的熔断器
+func (b *Breaker) Ready() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state != StateOpen || time.Since(b.openedAt) >= b.cfg.OpenTimeout
+}
+
+func (b *Breaker) Metrics() BreakerMetrics {
+	if b == nil {
+		return BreakerMetrics{}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	m := b.metrics
+	m.State = b.state
+	return m
+}
+
+func (b *Breaker) shouldOpen() bool {
+	if b.cfg.ConsecutiveFailures > 0 && b.consecutive >= b.cfg.ConsecutiveFailures {
+		return true
+	}
+	if b.cfg.ErrorRate > 0 && b.windowRequests >= b.cfg.MinRequests && b.windowRequests > 0 {
+		return float64(b.windowFailures)/float64(b.windowRequests) >= b.cfg.ErrorRate
+	}
+	return false
+}
+
+// 调用时必须持有b.mu
+func (b *Breaker) setState(state BreakerState) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	b.generation++
+	switch state {
+	case StateOpen:
+		b.openedAt = time.Now()
+		b.metrics.Opened++
+	case StateClosed:
+		b.consecutive = 0
+		b.windowStart = time.Now()
+		b.windowRequests, b.windowFailures = 0, 0
+	case StateHalfOpen:
+		b.probes = 0
+	}
+}
+
+func (b *Breaker) notify(from, to BreakerState) {
+	if from != to && b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(b.name, from, to)
+	}
+}
+
+func (b *Breaker) maxProbes() int {
+	if b.cfg.HalfOpenMaxProbes <= 0 {
+		return 1
+	}
+	return b.cfg.HalfOpenMaxProbes
+}
+
+func (b *Breaker) isFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	codes := b.cfg.FailureCodes
+	if len(codes) == 0 {
+		codes = DefaultBreakerConfig.FailureCodes
+	}
+	code := irpc.CodeOf(err)
+	for _, c := range codes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+func TestBreaker(t *testing.T) {
+	var transitions []BreakerState
+	b := NewBreaker("127.0.0.1:0", &BreakerConfig{
+		ConsecutiveFailures: 3,
+		OpenTimeout:         time.Millisecond * 50,
+		HalfOpenMaxProbes:   1,
+		OnStateChange: func(name string, from, to BreakerState) {
+			transitions = append(transitions, to)
+		},
+	})
+	ctx := context.Background()
+	unavailable := irpc.NewError(irpc.CodeUnavailable, "unavailable")
+	for i := 0; i < 3; i++ {
+		done, err := b.Allow(ctx)
+		_assert(err == nil, "closed breaker should allow requests")
+		done(unavailable)
+	}
+	_assert(b.State() == StateOpen, "expect open after 3 consecutive failures, got %s", b.State())
+	_assert(!b.Ready(), "open breaker should not be ready")
+	_, err := b.Allow(ctx)
+	_assert(err == ErrBreakerOpen, "open breaker should fail fast")
+
+	// 业务错误不算失败
+	time.Sleep(time.Millisecond * 60)
+	_assert(b.Ready(), "expect ready after the open timeout")
+	done, err := b.Allow(ctx)
+	_assert(err == nil, "expect a probe in half-open state")
+	_, err = b.Allow(ctx)
+	_assert(err == ErrBreakerOpen, "only one probe is allowed")
+	done(errors.New("handler error"))
+	_assert(b.State() == StateClosed, "expect closed after a successful probe, got %s", b.State())
+
+	m := b.Metrics()
+	_assert(m.Opened == 1 && m.Rejected == 2 && m.Failures == 3, "unexpected metrics %+v", m)
+	_assert(len(transitions) == 3 && transitions[0] == StateOpen && transitions[1] == StateHalfOpen &&
+		transitions[2] == StateClosed, "unexpected transitions %v", transitions)
+}
+
+func TestBreaker_StaleAndIgnored(t *testing.T) {
+	b := NewBreaker("127.0.0.1:0", &BreakerConfig{
+		ConsecutiveFailures: 1,
+		OpenTimeout:         time.Millisecond * 20,
+	})
+	ctx := context.Background()
+	unavailable := irpc.NewError(irpc.CodeUnavailable, "unavailable")
+	// 关闭时放行的请求在半开时才成功结束，不能当作探测结果
+	slow, _ := b.Allow(ctx)
+	failing, _ := b.Allow(ctx)
+	failing(unavailable)
+	time.Sleep(time.Millisecond * 30)
+	probe, err := b.Allow(ctx)
+	_assert(err == nil && b.State() == StateHalfOpen, "expect a probe, got %v %s", err, b.State())
+	slow(nil)
+	_assert(b.State() == StateHalfOpen, "a stale request should not close the breaker, got %s", b.State())
+	_, err = b.Allow(ctx)
+	_assert(err == ErrBreakerOpen, "the probe slot should still be taken")
+
+	// 调用方取消的探测只释放名额
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	probe(irpc.NewError(irpc.CodeDeadlineExceeded, "caller gave up"))
+	_assert(b.State() == StateOpen, "a real failure reopens the breaker, got %s", b.State())
+	time.Sleep(time.Millisecond * 30)
+	probe, err = b.Allow(canceled)
+	_assert(err == nil, "expect a probe, got %v", err)
+	probe(irpc.NewError(irpc.CodeDeadlineExceeded, "caller gave up"))
+	_assert(b.State() == StateHalfOpen, "a canceled probe should not change the state, got %s", b.State())
+	_, err = b.Allow(ctx)
+	_assert(err == nil, "the canceled probe should release its slot")
+	_assert(b.Metrics().Failures == 2, "caller errors are not failures, got %+v", b.Metrics())
+
+	var nilBreaker *Breaker
+	_assert(nilBreaker.State() == StateClosed && nilBreaker.Ready() && nilBreaker.Metrics() == BreakerMetrics{},
+		"nil breaker should report closed")
+}
+
+// 熔断器打开时重试也会被拒绝，Call直接返回，不等待退避也不消耗重试预算
+func TestBreaker_NoRetry(t *testing.T) {
+	c, err := Dial("tcp", newTestServer(t, nil, new(Echo)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	b := NewBreaker("echo", &BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	done, _ := b.Allow(context.Background())
+	done(irpc.NewError(irpc.CodeUnavailable, "unavailable"))
+	c.SetBreaker(b)
+	budget := NewRetryBudget(10, 0.1)
+	c.SetServiceConfig(&ServiceConfig{
+		Methods: map[string]*MethodConfig{"Echo.*": {Idempotent: true, Retry: &RetryPolicy{
+			MaxAttempts:    3,
+			InitialBackoff: time.Second,
+			RetryableCodes: []irpc.Code{irpc.CodeUnavailable},
+		}}},
+		Budget: budget,
+	})
+	start := time.Now()
+	var reply int
+	err = c.Call(context.Background(), "Echo.Echo", 1, &reply)
+	_assert(err == ErrBreakerOpen, "expect ErrBreakerOpen, got %v", err)
+	_assert(time.Since(start) < time.Millisecond*500, "expect no backoff, took %s", time.Since(start))
+	_assert(budget.tokens == 10, "expect the budget untouched, got %v", budget.tokens)
+}
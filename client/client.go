@@ -2,15 +2,18 @@ package client
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
+	"tinyRPCFramwork/code"
 	"tinyRPCFramwork/diyrpc"
 	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
 )
 
 // 封装一个结构体Call来承载一次RPC调用所要用到的信息
@@ -22,9 +25,18 @@ type Call struct {
 	Error         error
 	// Done是为异步设计的，告诉已经调用完成
 	Done chan *Call
+	// 通过Call发起时的ctx，ctx的截止时间会发给服务端
+	ctx context.Context
+	// 请求的消息类型，默认为KindCall
+	kind irpc.Kind
+	// 调用结束时记录指标，为空时不记录
+	finish func(irpc.Code)
 }
 
 func (c *Call) done() {
+	if c.finish != nil {
+		c.finish(irpc.CodeOf(c.Error))
+	}
 	c.Done <- c
 }
 
@@ -38,8 +50,28 @@ type Client struct {
 	pending  map[uint64]*Call
 	closing  bool
 	shutdown bool
+	// 按方法配置的重试策略
+	config *ServiceConfig
+	// 熔断器，为空时不熔断
+	breaker *Breaker
+	// 连接断开后关闭
+	dead chan struct{}
+	// 正在接收的服务端流
+	streams map[uint64]*stream
+	// 双向连接中客户端注册的服务，服务端通过连接调用它们
+	services map[string]*service.Service
+	// 正在处理的服务端调用，收到取消消息时取消其ctx
+	reverse map[uint64]context.CancelFunc
+	// 最后一次收到消息的时间，unix纳秒，心跳用它判断连接是否空闲
+	lastRecv atomic.Int64
+	// 连接断开的原因，不为空时代替读连接的错误
+	broken error
+	// 带服务端地址的Logger
+	logger irpc.Logger
 }
 
+var ErrShutdown = irpc.NewError(irpc.CodeUnavailable, "[Client] The Client has closing...")
+
 type clientResult struct {
 	client *Client
 	err    error
@@ -55,13 +87,24 @@ func dialTimeout(f newClientFunc, network, address string, opts ...*diyrpc.Optio
 	if err != nil {
 		return nil, err
 	}
+	conn = opt.Metrics.Conn(conn)
 	defer func() {
 		if err != nil {
 			conn.Close()
 		}
 	}()
+	if opt.TLSConfig != nil {
+		conn = tlsClient(conn, address, opt.TLSConfig)
+	}
 	ch := make(chan clientResult)
 	go func() {
+		// 握手也受连接超时的限制
+		if tc, ok := conn.(*tls.Conn); ok {
+			if err := tc.Handshake(); err != nil {
+				ch <- clientResult{err: irpc.NewError(irpc.CodeUnavailable, "[rpc client] tls handshake faild: "+err.Error())}
+				return
+			}
+		}
 		client, err := f(conn, opt)
 		ch <- clientResult{
 			client: client,
@@ -84,21 +127,27 @@ func (c *Client) Close() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.closing {
-		return errors.New("[Client] The Client has closing...")
+		return ErrShutdown
 	}
 	c.closing = true
 	return c.cc.Close()
 }
 
 func (c *Client) IsAvailable() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return !c.shutdown && !c.closing
 }
 func (c *Client) registerCall(call *Call) (uint64, error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.closing || c.shutdown {
-		log.Println("[Client] RegisterCall but client closing or shutdown")
-		return 0, errors.New("[Client] The Client has closing...")
+		c.logger.Debug("register call but client is closing or shutdown", "method", call.ServiceMethod)
+		return 0, ErrShutdown
+	}
+	// 调用方在发送前已经放弃了
+	if call.ctx != nil && call.ctx.Err() != nil {
+		return 0, irpc.ContextError(call.ctx, "[rpc client] call failed")
 	}
 	call.Seq = c.seq
 	c.pending[call.Seq] = call
@@ -109,12 +158,12 @@ func (c *Client) removeCall(seq uint64) *Call {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.closing || c.shutdown {
-		log.Println("[Client] RegisterCall but client closing or shutdown")
+		c.logger.Debug("remove call but client is closing or shutdown", "seq", seq)
 		return nil
 	}
 	call, ok := c.pending[seq]
 	if !ok {
-		log.Println("[Client] seq Call not exist")
+		c.logger.Debug("response for unknown call", "seq", seq)
 	}
 	delete(c.pending, seq)
 	return call
@@ -126,10 +175,22 @@ func (c *Client) terminateCalls(err error) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.shutdown = true
+	close(c.dead)
+	if c.broken != nil {
+		err = c.broken
+	}
 	for _, call := range c.pending {
-		call.Error = err
+		call.Error = irpc.Errorf(irpc.CodeUnavailable, "[Client] connection broken: %v", err)
 		call.done()
 	}
+	for seq, st := range c.streams {
+		st.finish(irpc.Errorf(irpc.CodeUnavailable, "[Client] connection broken: %v", err))
+		delete(c.streams, seq)
+	}
+	for seq, cancel := range c.reverse {
+		cancel()
+		delete(c.reverse, seq)
+	}
 }
 func (c *Client) receive() {
 	var err error
@@ -137,9 +198,22 @@ func (c *Client) receive() {
 		var h irpc.Header
 		err = c.cc.ReadHeader(&h)
 		if err != nil {
-			log.Println("[Client] Read Header faild")
+			c.logger.Debug("read header failed, connection closed", "err", err)
 			break
 		}
+		c.lastRecv.Store(time.Now().UnixNano())
+		if h.Kind == irpc.KindPong {
+			err = c.cc.ReadBody(nil)
+			continue
+		}
+		if h.Reverse {
+			err = c.serveReverse(&h)
+			continue
+		}
+		if h.Kind == irpc.KindStreamMsg || h.Kind == irpc.KindStreamEnd || h.Kind == irpc.KindWindowUpdate {
+			err = c.receiveStream(&h)
+			continue
+		}
 		// 表示这个call已经处理完，可以删除了
 		call := c.removeCall(h.Seq)
 		// 判断得到的call
@@ -151,12 +225,17 @@ func (c *Client) receive() {
 			// 给一个nil读body，自然会返回一个err
 			err = c.cc.ReadBody(nil)
 		case h.Error != "":
-			call.Error = fmt.Errorf(h.Error)
+			call.Error = irpc.HeaderError(&h)
 			err = c.cc.ReadBody(nil)
 			call.done()
 		default:
 			err = c.cc.ReadBody(call.reply)
-			if err != nil {
+			var tooLarge *code.TooLargeError
+			if errors.As(err, &tooLarge) && !tooLarge.Fatal {
+				// 过大的响应已经被跳过，只有这个调用失败
+				call.Error = irpc.NewError(irpc.CodeResourceExhausted, "[Client] response "+tooLarge.Error())
+				err = nil
+			} else if err != nil {
 				call.Error = errors.New("[Client] Reading body" + err.Error())
 			}
 			call.done()
@@ -164,31 +243,61 @@ func (c *Client) receive() {
 	}
 	c.terminateCalls(err)
 }
-func newClientCode(cc irpc.ICode, opt *diyrpc.Option) *Client {
+func newClientCode(cc irpc.ICode, logger irpc.Logger, opt *diyrpc.Option, services map[string]*service.Service) *Client {
 	client := &Client{
-		seq:     1,
-		cc:      cc,
-		opt:     opt,
-		pending: make(map[uint64]*Call),
+		seq:      1,
+		cc:       cc,
+		opt:      opt,
+		pending:  make(map[uint64]*Call),
+		dead:     make(chan struct{}),
+		streams:  make(map[uint64]*stream),
+		services: services,
+		reverse:  make(map[uint64]context.CancelFunc),
+		logger:   logger,
 	}
+	client.lastRecv.Store(time.Now().UnixNano())
 	go client.receive()
+	if opt.Heartbeat > 0 {
+		go client.heartbeat(opt.Heartbeat, opt.HeartbeatTimeout)
+	}
 	return client
 }
 func newClient(conn net.Conn, opt *diyrpc.Option) (*Client, error) {
+	return newClientServices(conn, opt, nil)
+}
+
+func newClientServices(conn net.Conn, opt *diyrpc.Option, services map[string]*service.Service) (*Client, error) {
+	logger := irpc.With(irpc.LoggerOr(opt.Logger), "component", "client", "remote", conn.RemoteAddr().String())
 	f := irpc.NewCodeFuncMap[opt.CodeType]
 	if f == nil {
 		err := fmt.Errorf("[Client] Invaild CodeType: %s", opt.CodeType)
-		//log.Println(opt.CodeType)
-		log.Println("[Client] NewCodeFuncMap err:", err)
+		logger.Error("invalid code type", "type", opt.CodeType)
 		conn.Close()
 		return nil, err
 	}
 	if err := json.NewEncoder(conn).Encode(opt); err != nil {
-		log.Println("[Client] Send Option faild: ", err)
+		logger.Error("send option failed", "err", err)
 		conn.Close()
 		return nil, err
 	}
-	return newClientCode(f(conn), opt), nil
+	// 设置了HandshakeResult，服务端总是返回握手结果，认证失败时在这里返回服务端的错误
+	ac, err := authenticate(conn, opt.Credentials)
+	if err != nil {
+		logger.Error("handshake failed", "err", err)
+		conn.Close()
+		return nil, err
+	}
+	cc := f(ac)
+	if lc, ok := cc.(code.Limited); ok {
+		lc.SetLimits(opt.Limits)
+	}
+	if lc, ok := cc.(code.Logged); ok {
+		lc.SetLogger(logger)
+	}
+	if opt.SigningKey != nil {
+		cc = code.NewSigningCode(cc, opt.SigningKey)
+	}
+	return newClientCode(cc, logger, opt, services), nil
 }
 
 // 设置opts为可选参数
@@ -199,13 +308,15 @@ func parseOptions(opts ...*diyrpc.Option) (*diyrpc.Option, error) {
 	if len(opts) != 1 {
 		return nil, errors.New("The number of options is more than 1")
 	}
-	opt := opts[0]
+	// 复制一份，避免修改调用方的Option
+	o := *opts[0]
+	opt := &o
 	opt.MarkedDiyrpc = diyrpc.DefaultOption.MarkedDiyrpc
+	// 总是读取握手结果，见Option.HandshakeResult
+	opt.HandshakeResult = true
 	if opt.CodeType == "" {
 		opt.CodeType = diyrpc.DefaultOption.CodeType
 	}
-	// for test
-	opt.CodeType = irpc.GobType
 	return opt, nil
 }
 func Dial(network, address string, opts ...*diyrpc.Option) (client *Client, err error) {
@@ -234,7 +345,7 @@ func (c *Client) send(call *Call) {
 
 	seq, err := c.registerCall(call)
 	if err != nil {
-		log.Println("[Client] registerCall err:", err)
+		c.logger.Debug("register call failed", "method", call.ServiceMethod, "err", err)
 		call.Error = err
 		call.done()
 		return
@@ -242,10 +353,13 @@ func (c *Client) send(call *Call) {
 	c.header.ServiceMethod = call.ServiceMethod
 	c.header.Seq = seq
 	c.header.Error = ""
+	c.header.Kind = call.kind
+	c.header.Window = 0
+	c.header.Timeout = timeoutOf(call.ctx)
 	if err := c.cc.Write(&c.header, call.Args); err != nil {
 		call := c.removeCall(seq)
 		if call != nil {
-			call.Error = err
+			call.Error = irpc.NewError(irpc.CodeUnavailable, err.Error())
 			call.done()
 		}
 	}
@@ -254,24 +368,160 @@ func (c *Client) Go(serviceMethod string, args, reply interface{}, done chan *Ca
 	if done == nil {
 		done = make(chan *Call, 10)
 	} else if cap(done) == 0 {
-		log.Panic("[Client] done channel unbuffered")
+		panic("[Client] done channel unbuffered")
 	}
 	call := &Call{
 		ServiceMethod: serviceMethod,
 		Args:          args,
 		reply:         reply,
 		Done:          done,
+		finish:        c.opt.Metrics.Start(serviceMethod),
 	}
 	c.send(call)
 	return call
 }
+
+// 单向调用，请求写入连接后立即返回，服务端执行方法但不返回响应，
+// 方法的返回值和错误都会被丢弃，也不会占用pending
+func (c *Client) Notify(serviceMethod string, args interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	c.mu.Lock()
+	if c.closing || c.shutdown {
+		c.mu.Unlock()
+		return ErrShutdown
+	}
+	// seq仍然要分配，服务端用它区分同一个连接上的请求
+	seq := c.seq
+	c.seq++
+	c.mu.Unlock()
+	h := &irpc.Header{ServiceMethod: serviceMethod, Seq: seq, OneWay: true}
+	if err := c.cc.Write(h, args); err != nil {
+		return irpc.NewError(irpc.CodeUnavailable, err.Error())
+	}
+	return nil
+}
+
+// 设置按方法的调用配置，幂等的方法会按照其重试策略重试
+func (c *Client) SetServiceConfig(sc *ServiceConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = sc
+}
+
+// 设置熔断器，熔断器打开时Call直接返回ErrBreakerOpen
+func (c *Client) SetBreaker(b *Breaker) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.breaker = b
+}
+
 func (c *Client) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
-	call := <-c.Go(serviceMethod, args, reply, make(chan *Call, 1)).Done
+	c.mu.Lock()
+	sc, breaker := c.config, c.breaker
+	c.mu.Unlock()
+	return sc.Do(ctx, serviceMethod, func(attempt int) error {
+		done, err := breaker.Allow(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.call(ctx, serviceMethod, args, reply)
+		done(err)
+		return err
+	})
+}
+
+// 一次调用，不重试
+// 发送在另一个goroutine中进行，等待发送和等待结果时都能响应ctx
+func (c *Client) call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if ctx.Err() != nil {
+		return irpc.ContextError(ctx, "[rpc client] call failed")
+	}
+	return c.wait(ctx, &Call{
+		ServiceMethod: serviceMethod,
+		Args:          args,
+		reply:         reply,
+		Done:          make(chan *Call, 1),
+		ctx:           ctx,
+		finish:        c.opt.Metrics.Start(serviceMethod),
+	})
+}
+
+// 发送call并等待结果，ctx结束时放弃
+func (c *Client) wait(ctx context.Context, call *Call) error {
+	go c.send(call)
 	select {
 	case <-ctx.Done():
-		c.removeCall(call.Seq)
-		return errors.New("[rpc client] call failed:" + ctx.Err().Error())
+		c.abandon(call)
+		err := irpc.ContextError(ctx, "[rpc client] call failed")
+		// 结果可能已经在路上，finish只记录先到的一个
+		if call.finish != nil {
+			call.finish(irpc.CodeOf(err))
+		}
+		return err
 	case call := <-call.Done:
 		return call.Error
 	}
 }
+
+var ErrCanceled = irpc.NewError(irpc.CodeCanceled, "[Client] call canceled")
+
+// 放弃一个通过Go发起、还没有返回的调用，通知服务端取消请求，
+// 服务端会取消方法的ctx并且不再返回结果，call以ErrCanceled结束
+func (c *Client) Cancel(call *Call) {
+	if c.abandon(call) {
+		call.Error = ErrCanceled
+		call.done()
+	}
+}
+
+// 从pending中移除call，如果请求已经发出，通知服务端取消
+// call还在pending中时返回true
+func (c *Client) abandon(call *Call) bool {
+	c.mu.Lock()
+	_, sent := c.pending[call.Seq]
+	if sent {
+		delete(c.pending, call.Seq)
+	}
+	seq := call.Seq
+	c.mu.Unlock()
+	if sent {
+		go c.sendCancel(seq)
+	}
+	return sent
+}
+
+func (c *Client) sendCancel(seq uint64) {
+	c.sendControl(&irpc.Header{Seq: seq, Kind: irpc.KindCancel})
+}
+
+// 发送没有body的控制消息
+func (c *Client) sendControl(h *irpc.Header) {
+	if err := c.write(h, struct{}{}); err != nil {
+		c.logger.Warn("send control message failed", "kind", h.Kind, "seq", h.Seq, "err", err)
+	}
+}
+
+// 在发送锁内写一条消息
+func (c *Client) write(h *irpc.Header, body interface{}) error {
+	c.sending.Lock()
+	defer c.sending.Unlock()
+	if !c.IsAvailable() {
+		return ErrShutdown
+	}
+	if err := c.cc.Write(h, body); err != nil {
+		return irpc.NewError(irpc.CodeUnavailable, err.Error())
+	}
+	return nil
+}
+
+// ctx剩余的时间，没有截止时间时返回0
+func timeoutOf(ctx context.Context) time.Duration {
+	if ctx == nil {
+		return 0
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		return time.Until(deadline)
+	}
+	return 0
+}
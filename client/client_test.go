@@ -2,13 +2,17 @@ package client
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"strings"
 	"testing"
 	"time"
 	"tinyRPCFramwork/code"
 	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
 )
 
 func _assert(condition bool, msg string, v ...interface{}) {
@@ -17,6 +21,15 @@ func _assert(condition bool, msg string, v ...interface{}) {
 	}
 }
 
+// 编码器只在包初始化时注册，测试中不再修改NewCodeFuncMap，
+// 否则会和之前的测试中还没有退出的服务端并发读写
+func init() {
+	code.Init()
+	irpc.NewCodeFuncMap[jsonValues] = func(conn io.ReadWriteCloser) irpc.ICode {
+		return jsonValueCode{ICode: code.NewGobCode(conn)}
+	}
+}
+
 func TestClient_dialTimeout(t *testing.T) {
 	t.Parallel()
 	l, _ := net.Listen("tcp", ":0")
@@ -27,7 +40,6 @@ func TestClient_dialTimeout(t *testing.T) {
 		return nil, nil
 	}
 	t.Run("timeout", func(t *testing.T) {
-		code.Init()
 		_, err := dialTimeout(f, "tcp", l.Addr().String(), &diyrpc.Option{ConnectionTimeout: time.Second})
 		_assert(err != nil && strings.Contains(err.Error(), "connect create timeout"), "expect a timeout error")
 	})
@@ -44,6 +56,31 @@ func (b Bar) Timeout(argv int, reply *int) error {
 	return nil
 }
 
+// 返回ctx剩余的毫秒数
+func (b Bar) Deadline(ctx context.Context, argv int, reply *int) error {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return errors.New("no deadline")
+	}
+	*reply = int(time.Until(deadline) / time.Millisecond)
+	return nil
+}
+
+var barCanceled = make(chan struct{}, 1)
+
+func (b Bar) Block(ctx context.Context, argv int, reply *int) error {
+	<-ctx.Done()
+	barCanceled <- struct{}{}
+	return ctx.Err()
+}
+
+var barNotes = make(chan int, 10)
+
+func (b Bar) Note(argv int, reply *int) error {
+	barNotes <- argv
+	return nil
+}
+
 func startServer(addr chan string) {
 	var b Bar
 	_ = diyrpc.Register(&b)
@@ -55,14 +92,14 @@ func startServer(addr chan string) {
 
 func TestClient_Call(t *testing.T) {
 	t.Parallel()
-	code.Init()
 	addrCh := make(chan string)
 	go startServer(addrCh)
 	addr := <-addrCh
 	time.Sleep(time.Second)
 	t.Run("client timeout", func(t *testing.T) {
 		client, _ := Dial("tcp", addr)
-		ctx, _ := context.WithTimeout(context.Background(), time.Second)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
 		var reply int
 		err := client.Call(ctx, "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), ctx.Err().Error()), "expect a timeout error")
@@ -75,4 +112,118 @@ func TestClient_Call(t *testing.T) {
 		err := client.Call(context.Background(), "Bar.Timeout", 1, &reply)
 		_assert(err != nil && strings.Contains(err.Error(), "handle timeout"), "expect a timeout error")
 	})
+	t.Run("deadline propagation", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*2)
+		defer cancel()
+		var reply int
+		err := client.Call(ctx, "Bar.Deadline", 1, &reply)
+		_assert(err == nil && reply > 0 && reply <= 2000, "expect the server to see the client deadline, got %d %v", reply, err)
+	})
+	t.Run("cancel", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			time.Sleep(time.Millisecond * 100)
+			cancel()
+		}()
+		var reply int
+		err := client.Call(ctx, "Bar.Block", 1, &reply)
+		_assert(err != nil && strings.Contains(err.Error(), context.Canceled.Error()), "expect a cancel error")
+		select {
+		case <-barCanceled:
+		case <-time.After(time.Second):
+			_assert(false, "expect the server to cancel the handler")
+		}
+	})
+	t.Run("cancel go", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		canceled := diyrpc.DefaultServer.Stats().Canceled
+		var reply int
+		call := client.Go("Bar.Block", 1, &reply, nil)
+		time.Sleep(time.Millisecond * 100)
+		client.Cancel(call)
+		call = <-call.Done
+		_assert(call.Error == ErrCanceled, "expect ErrCanceled, got %v", call.Error)
+		select {
+		case <-barCanceled:
+		case <-time.After(time.Second):
+			_assert(false, "expect the server to cancel the handler")
+		}
+		_assert(diyrpc.DefaultServer.Stats().Canceled > canceled, "expect the cancel to be counted")
+	})
+	t.Run("notify", func(t *testing.T) {
+		client, _ := Dial("tcp", addr)
+		_assert(client.Notify("Bar.Note", 7) == nil, "notify failed")
+		select {
+		case n := <-barNotes:
+			_assert(n == 7, "expect 7, got %d", n)
+		case <-time.After(time.Second):
+			_assert(false, "expect the server to run the one-way call")
+		}
+		client.mu.Lock()
+		pending := len(client.pending)
+		client.mu.Unlock()
+		_assert(pending == 0, "expect no pending call, got %d", pending)
+	})
+	t.Run("notify no response", func(t *testing.T) {
+		// 直接读连接，单向调用不应该有任何响应，即使方法不存在
+		conn := rawDial(t, addr)
+		cc := code.NewGobCode(conn)
+		_ = cc.Write(&irpc.Header{ServiceMethod: "Bar.Missing", Seq: 1, OneWay: true}, 1)
+		_ = cc.Write(&irpc.Header{ServiceMethod: "Bar.Note", Seq: 2, OneWay: true}, 2)
+		_ = cc.Write(&irpc.Header{ServiceMethod: "Bar.Deadline", Seq: 3}, 3)
+		var h irpc.Header
+		_assert(cc.ReadHeader(&h) == nil && h.Seq == 3, "expect the first response to be seq 3, got %d", h.Seq)
+		<-barNotes
+	})
+}
+
+// 启动一个测试用的服务端，configure在注册服务前修改Server的配置，可以为nil，
+// 测试结束时关闭监听，返回监听的地址
+func newTestServer(t *testing.T, configure func(*diyrpc.Server), rcvrs ...interface{}) string {
+	t.Helper()
+	s := diyrpc.NewServer()
+	if configure != nil {
+		configure(s)
+	}
+	for _, rcvr := range rcvrs {
+		if err := s.Register(rcvr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+// 直接连接服务端，发送Option并读取握手结果，之后可以在连接上直接读写消息
+func rawDial(t *testing.T, addr string) net.Conn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	if err := json.NewEncoder(conn).Encode(diyrpc.DefaultOption); err != nil {
+		t.Fatal(err)
+	}
+	// 逐字节读到换行符，不能多读后面的消息
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) == 0 || line[len(line)-1] != '\n' {
+		if _, err := conn.Read(b); err != nil {
+			t.Fatal(err)
+		}
+		line = append(line, b[0])
+	}
+	var result diyrpc.AuthMessage
+	if err := json.Unmarshal(line, &result); err != nil || !result.Done || result.Error != "" {
+		t.Fatalf("handshake failed: %s %v", line, err)
+	}
+	return conn
 }
@@ -0,0 +1,38 @@
+package client
+
+import (
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 在心跳超时时间内没有收到服务端的任何消息，连接被关闭
+var ErrHeartbeatTimeout = irpc.NewError(irpc.CodeUnavailable, "[Client] heartbeat timeout: server stopped responding")
+
+// 连接空闲时发送心跳，超时没有收到消息时断开连接，
+// 正在进行的调用和流以ErrHeartbeatTimeout结束
+func (c *Client) heartbeat(interval, timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = 3 * interval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.dead:
+			return
+		case <-ticker.C:
+		}
+		idle := time.Since(time.Unix(0, c.lastRecv.Load()))
+		if idle >= timeout {
+			c.mu.Lock()
+			c.broken = ErrHeartbeatTimeout
+			c.mu.Unlock()
+			// 关闭连接后接收循环退出，由它结束所有调用
+			_ = c.cc.Close()
+			return
+		}
+		if idle >= interval {
+			_ = c.write(&irpc.Header{Kind: irpc.KindPing}, struct{}{})
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+func TestHeartbeat(t *testing.T) {
+	addr := newTestServer(t, func(s *diyrpc.Server) {
+		s.SetIdleTimeout(100 * time.Millisecond)
+	}, new(Echo))
+
+	t.Run("idle connection closed", func(t *testing.T) {
+		conn := rawDial(t, addr)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		start := time.Now()
+		if _, err := conn.Read(make([]byte, 1)); err == nil || strings.Contains(err.Error(), "timeout") {
+			t.Fatalf("expect the server to close the connection, got %v", err)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("closed after %s", d)
+		}
+	})
+	t.Run("heartbeat keeps long call alive", func(t *testing.T) {
+		c, err := Dial("tcp", addr, &diyrpc.Option{Heartbeat: 20 * time.Millisecond})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		var reply int
+		if err := c.Call(context.Background(), "Echo.Sleep", 300, &reply); err != nil || reply != 300 {
+			t.Fatalf("got %d, %v", reply, err)
+		}
+	})
+	t.Run("no heartbeat", func(t *testing.T) {
+		c, err := Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		time.Sleep(200 * time.Millisecond)
+		var reply int
+		if err := c.Call(context.Background(), "Echo.Sleep", 1, &reply); irpc.CodeOf(err) != irpc.CodeUnavailable {
+			t.Fatalf("expect the idle connection to be closed, got %v", err)
+		}
+	})
+	t.Run("dead server", func(t *testing.T) {
+		// 读完Option后不再回复任何消息，模拟对端消失
+		dead, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer func() { _ = dead.Close() }()
+		go func() {
+			conn, err := dead.Accept()
+			if err != nil {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			_, _ = conn.Read(make([]byte, 1024))
+			_ = json.NewEncoder(conn).Encode(&diyrpc.AuthMessage{Done: true})
+			time.Sleep(time.Second)
+		}()
+		c, err := Dial("tcp", dead.Addr().String(), &diyrpc.Option{
+			Heartbeat:        20 * time.Millisecond,
+			HeartbeatTimeout: 60 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		start := time.Now()
+		var reply int
+		err = c.Call(context.Background(), "Echo.Sleep", 1, &reply)
+		if irpc.CodeOf(err) != irpc.CodeUnavailable || !strings.Contains(err.Error(), "heartbeat timeout") {
+			t.Fatalf("expect heartbeat timeout, got %v", err)
+		}
+		if d := time.Since(start); d > 500*time.Millisecond {
+			t.Fatalf("detected after %s", d)
+		}
+	})
+}
+
+// 空闲超时后阻塞在Recv中的流方法要被取消，处理连接的goroutine才能退出
+func TestIdleTimeoutAbortsStreams(t *testing.T) {
+	s := diyrpc.NewServer()
+	_ = s.Register(new(Summer))
+	s.SetIdleTimeout(100 * time.Millisecond)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = l.Close() }()
+	served := make(chan struct{})
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		s.ServeConn(conn)
+		close(served)
+	}()
+	c, err := Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	w, err := ClientStream[int, int](context.Background(), c, "Summer.Sum")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Send(1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-served:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeConn still running after the idle timeout")
+	}
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type Blob struct{}
+
+func (b *Blob) Len(args string, reply *int) error {
+	*reply = len(args)
+	return nil
+}
+
+func (b *Blob) Repeat(n int, reply *string) error {
+	*reply = strings.Repeat("x", n)
+	return nil
+}
+
+func startLimitServer(t *testing.T, l *code.Limits) string {
+	return newTestServer(t, func(s *diyrpc.Server) { s.SetLimits(l) }, new(Blob))
+}
+
+func TestMessageLimits(t *testing.T) {
+	ctx := context.Background()
+	length := func(c *Client, s string) (int, error) {
+		var n int
+		err := c.Call(ctx, "Blob.Len", s, &n)
+		return n, err
+	}
+	addr := startLimitServer(t, &code.Limits{MaxHeaderSize: 256, MaxBodySize: 1024})
+
+	t.Run("oversized body", func(t *testing.T) {
+		c, _ := Dial("tcp", addr)
+		defer func() { _ = c.Close() }()
+		if n, err := length(c, "small"); err != nil || n != 5 {
+			t.Fatalf("got %d, %v", n, err)
+		}
+		if _, err := length(c, strings.Repeat("x", 4096)); irpc.CodeOf(err) != irpc.CodeResourceExhausted {
+			t.Fatalf("expect ResourceExhausted, got %v", err)
+		}
+		// 过大的body被跳过，连接仍然可用
+		if n, err := length(c, "again"); err != nil || n != 5 {
+			t.Fatalf("got %d, %v", n, err)
+		}
+	})
+	t.Run("oversized header", func(t *testing.T) {
+		c, _ := Dial("tcp", addr)
+		defer func() { _ = c.Close() }()
+		var n int
+		err := c.Call(ctx, "Blob."+strings.Repeat("x", 1024), "", &n)
+		if irpc.CodeOf(err) != irpc.CodeUnavailable {
+			t.Fatalf("expect the connection to be closed, got %v", err)
+		}
+	})
+	t.Run("close on oversize", func(t *testing.T) {
+		addr := startLimitServer(t, &code.Limits{MaxBodySize: 1024, CloseOnOversize: true})
+		c, _ := Dial("tcp", addr)
+		defer func() { _ = c.Close() }()
+		if _, err := length(c, strings.Repeat("x", 4096)); irpc.CodeOf(err) != irpc.CodeUnavailable {
+			t.Fatalf("expect the connection to be closed, got %v", err)
+		}
+	})
+	t.Run("client limit", func(t *testing.T) {
+		c, _ := Dial("tcp", addr, &diyrpc.Option{Limits: &code.Limits{MaxBodySize: 512}})
+		defer func() { _ = c.Close() }()
+		var s string
+		if err := c.Call(ctx, "Blob.Repeat", 4096, &s); irpc.CodeOf(err) != irpc.CodeResourceExhausted {
+			t.Fatalf("expect ResourceExhausted, got %v", err)
+		}
+		if err := c.Call(ctx, "Blob.Repeat", 3, &s); err != nil || s != "xxx" {
+			t.Fatalf("got %q, %v", s, err)
+		}
+	})
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+type logEntry struct {
+	level  irpc.Level
+	msg    string
+	fields map[string]string
+}
+
+// 记录所有日志，用于检查日志中的字段
+type captureLogger struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *captureLogger) Debug(msg string, args ...interface{}) { l.add(irpc.LevelDebug, msg, args) }
+func (l *captureLogger) Info(msg string, args ...interface{})  { l.add(irpc.LevelInfo, msg, args) }
+func (l *captureLogger) Warn(msg string, args ...interface{})  { l.add(irpc.LevelWarn, msg, args) }
+func (l *captureLogger) Error(msg string, args ...interface{}) { l.add(irpc.LevelError, msg, args) }
+
+func (l *captureLogger) add(level irpc.Level, msg string, args []interface{}) {
+	e := logEntry{level: level, msg: msg, fields: make(map[string]string)}
+	for i := 0; i+1 < len(args); i += 2 {
+		e.fields[fmt.Sprint(args[i])] = fmt.Sprint(args[i+1])
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries = append(l.entries, e)
+}
+
+// 等待msg的日志出现
+func (l *captureLogger) wait(t *testing.T, msg string) logEntry {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		l.mu.Lock()
+		for _, e := range l.entries {
+			if e.msg == msg {
+				l.mu.Unlock()
+				return e
+			}
+		}
+		l.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("no log %q", msg)
+	return logEntry{}
+}
+
+type hidden struct{}
+
+func (h *hidden) Sum(args int, reply *int) error { return nil }
+
+func TestLogger(t *testing.T) {
+	serverLog := new(captureLogger)
+	var s *diyrpc.Server
+	addr := newTestServer(t, func(srv *diyrpc.Server) {
+		s = srv
+		s.SetLogger(serverLog)
+	}, new(Echo))
+
+	t.Run("invalid service name", func(t *testing.T) {
+		if err := s.Register(new(hidden)); err == nil {
+			t.Fatal("expect an error for an unexported service name")
+		}
+		if _, err := DialBidirectional("tcp", addr, []interface{}{new(hidden)}); err == nil {
+			t.Fatal("expect an error for an unexported service name")
+		}
+	})
+	t.Run("register", func(t *testing.T) {
+		e := serverLog.wait(t, "register method")
+		if e.level != irpc.LevelDebug || e.fields["service"] != "Echo" || e.fields["method"] == "" {
+			t.Fatalf("got %+v", e)
+		}
+	})
+	t.Run("request fields", func(t *testing.T) {
+		conn := rawDial(t, addr)
+		// Echo.Sleep的参数是int，发送string时服务端读参数失败
+		cc := code.NewGobCodeOption(conn, nil)
+		_ = cc.Write(&irpc.Header{ServiceMethod: "Echo.Sleep", Seq: 7}, "seven")
+		e := serverLog.wait(t, "read argv failed")
+		if e.level != irpc.LevelWarn || e.fields["method"] != "Echo.Sleep" || e.fields["seq"] != "7" ||
+			e.fields["remote"] != conn.LocalAddr().String() || e.fields["component"] != "server" {
+			t.Fatalf("got %+v", e)
+		}
+	})
+	t.Run("client", func(t *testing.T) {
+		clientLog := new(captureLogger)
+		c, err := Dial("tcp", addr, &diyrpc.Option{Logger: clientLog})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = c.Close()
+		e := clientLog.wait(t, "read header failed, connection closed")
+		if e.fields["remote"] != addr || e.fields["component"] != "client" {
+			t.Fatalf("got %+v", e)
+		}
+	})
+}
+
+func TestStdLogger(t *testing.T) {
+	var out strings.Builder
+	l := &irpc.StdLogger{Logger: log.New(&out, "", 0), Level: irpc.LevelInfo}
+	l.Debug("dropped")
+	irpc.With(l, "remote", "1.2.3.4:5").Warn("slow call", "method", "Echo.Sleep", "odd")
+	if got, want := out.String(), "WARN slow call remote=1.2.3.4:5 method=Echo.Sleep !BADKEY=odd\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	// 经过With包装后记录的仍然是调用方的位置
+	out.Reset()
+	l.Logger.SetFlags(log.Lshortfile)
+	irpc.With(irpc.With(l, "a", 1), "b", 2).Info("where")
+	if got := out.String(); !strings.HasPrefix(got, "log_test.go:") {
+		t.Fatalf("expect the caller's file, got %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	reg := metrics.NewRegistry()
+	serverMetrics := metrics.NewServerMetrics(reg)
+	clientMetrics := metrics.NewClientMetrics(reg)
+	addr := newTestServer(t, func(s *diyrpc.Server) {
+		s.SetMetrics(serverMetrics)
+	}, new(Echo))
+
+	c, err := Dial("tcp", addr, &diyrpc.Option{Metrics: clientMetrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	var reply int
+	for i := 0; i < 3; i++ {
+		if err := c.Call(context.Background(), "Echo.Echo", i, &reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = c.Call(context.Background(), "Echo.Missing", 1, &reply)
+	_ = c.Call(context.Background(), "Nobody.Missing", 1, &reply)
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+	_ = c.Call(ctx, "Echo.Sleep", 200, &reply)
+	// 等服务端处理完被取消的请求
+	time.Sleep(250 * time.Millisecond)
+
+	if v := serverMetrics.Requests.With("Echo.Echo", "OK").Value(); v != 3 {
+		t.Fatalf("server Echo.Echo OK = %v", v)
+	}
+	if v := serverMetrics.Requests.With("unknown", "NotFound").Value(); v != 2 {
+		t.Fatalf("server unknown NotFound = %v", v)
+	}
+	if v := serverMetrics.Requests.With("Echo.Sleep", "Canceled").Value(); v != 1 {
+		t.Fatalf("server Echo.Sleep Canceled = %v", v)
+	}
+	if v := clientMetrics.Requests.With("Echo.Missing", "NotFound").Value(); v != 1 {
+		t.Fatalf("client Echo.Missing NotFound = %v", v)
+	}
+	if v := clientMetrics.Requests.With("Echo.Sleep", "Canceled").Value(); v != 1 {
+		t.Fatalf("client Echo.Sleep Canceled = %v", v)
+	}
+	if n := clientMetrics.Latency.With("Echo.Echo").Count(); n != 3 {
+		t.Fatalf("client latency count = %d", n)
+	}
+	if v := serverMetrics.InFlight.With("Echo.Sleep").Value(); v != 0 {
+		t.Fatalf("server in flight = %v", v)
+	}
+	if v := serverMetrics.Connections.With().Value(); v != 1 {
+		t.Fatalf("server connections = %v", v)
+	}
+	if in, out := serverMetrics.BytesIn.With().Value(), clientMetrics.BytesOut.With().Value(); in == 0 || in != out {
+		t.Fatalf("server received %v bytes, client sent %v", in, out)
+	}
+
+	srv := httptest.NewServer(reg)
+	defer srv.Close()
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, _ := io.ReadAll(resp.Body)
+	for _, line := range []string{
+		"# TYPE diyrpc_server_request_duration_seconds histogram",
+		`diyrpc_server_requests_total{method="Echo.Echo",code="OK"} 3`,
+		`diyrpc_client_request_duration_seconds_count{method="Echo.Echo"} 3`,
+		"diyrpc_client_connections 1",
+	} {
+		if !strings.Contains(string(body), line+"\n") {
+			t.Fatalf("missing %q in\n%s", line, body)
+		}
+	}
+
+	_ = c.Close()
+	time.Sleep(50 * time.Millisecond)
+	if v := clientMetrics.Connections.With().Value(); v != 0 {
+		t.Fatalf("client connections after close = %v", v)
+	}
+	if v := serverMetrics.Connections.With().Value(); v != 0 {
+		t.Fatalf("server connections after close = %v", v)
+	}
+}
+
+// 流调用也要记录请求数、延迟和进行中的请求数
+func TestMetrics_Stream(t *testing.T) {
+	clientMetrics := metrics.NewClientMetrics(metrics.NewRegistry())
+	c, err := Dial("tcp", newTestServer(t, nil, new(Counter), new(Summer)), &diyrpc.Option{Metrics: clientMetrics})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	r, err := ServerStream[int](context.Background(), c, "Counter.Count", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range r.Chan() {
+	}
+	r, _ = ServerStream[int](context.Background(), c, "Counter.Fail", 1)
+	for range r.Chan() {
+	}
+	w, _ := ClientStream[int, int](context.Background(), c, "Summer.Sum")
+	_ = w.Send(1)
+	if _, err := w.CloseAndRecv(); err != nil {
+		t.Fatal(err)
+	}
+	r, _ = ServerStream[int](context.Background(), c, "Counter.Count", 1000)
+	r.Close()
+	// 客户端流在收到reply之后才收到流结束
+	time.Sleep(50 * time.Millisecond)
+
+	if v := clientMetrics.Requests.With("Counter.Count", "OK").Value(); v != 1 {
+		t.Fatalf("client Counter.Count OK = %v", v)
+	}
+	if v := clientMetrics.Requests.With("Counter.Fail", "Unknown").Value(); v != 1 {
+		t.Fatalf("client Counter.Fail Unknown = %v", v)
+	}
+	if v := clientMetrics.Requests.With("Summer.Sum", "OK").Value(); v != 1 {
+		t.Fatalf("client Summer.Sum OK = %v", v)
+	}
+	if v := clientMetrics.Requests.With("Counter.Count", "Canceled").Value(); v != 1 {
+		t.Fatalf("client Counter.Count Canceled = %v", v)
+	}
+	if n := clientMetrics.Latency.With("Counter.Count").Count(); n != 2 {
+		t.Fatalf("client Counter.Count latency count = %d", n)
+	}
+	for _, method := range []string{"Counter.Count", "Counter.Fail", "Summer.Sum"} {
+		if v := clientMetrics.InFlight.With(method).Value(); v != 0 {
+			t.Fatalf("client %s in flight = %v", method, v)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+)
+
+type PoolOption struct {
+	// 至少保持的连接数
+	MinConns int
+	// 最多的连接数
+	MaxConns int
+	// 每个连接上未完成的调用数达到这个值时新建连接，
+	// 连接数已经达到MaxConns时仍然选择负载最小的连接
+	MaxPendingPerConn int
+	// 连接空闲超过这个时间会被关闭，但至少保留MinConns个，0表示不关闭
+	IdleTimeout time.Duration
+	// 健康检查和回收空闲连接的间隔，0表示不检查
+	HealthCheckInterval time.Duration
+	// 健康检查时调用的方法，参数和返回值都是int，为空时只检查连接是否断开
+	HealthCheckMethod string
+	// 健康检查调用的超时时间
+	HealthCheckTimeout time.Duration
+}
+
+var DefaultPoolOption = &PoolOption{
+	MinConns:            1,
+	MaxConns:            8,
+	MaxPendingPerConn:   64,
+	IdleTimeout:         time.Minute,
+	HealthCheckInterval: time.Second * 10,
+	HealthCheckTimeout:  time.Second,
+}
+
+type pooledConn struct {
+	c *Client
+	// 通过连接池发出、还没有返回的调用数
+	inflight int
+	lastUsed time.Time
+}
+
+// 同一个地址的连接池，把调用分散到多个连接上
+type Pool struct {
+	network string
+	address string
+	opt     *diyrpc.Option
+	popt    *PoolOption
+
+	mu    sync.Mutex
+	conns []*pooledConn
+	// 正在新建的连接数
+	dialing int
+	// 每次拨号结束时关闭并换成新的channel，唤醒等待拨号结果的调用
+	dialDone chan struct{}
+	// 最近一次拨号的错误
+	dialErr error
+	closed  bool
+	closing chan struct{}
+}
+
+func NewPool(network, address string, popt *PoolOption, opts ...*diyrpc.Option) (*Pool, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if popt == nil {
+		popt = DefaultPoolOption
+	}
+	p := &Pool{
+		network:  network,
+		address:  address,
+		opt:      opt,
+		popt:     popt,
+		dialDone: make(chan struct{}),
+		closing:  make(chan struct{}),
+	}
+	for i := 0; i < popt.MinConns; i++ {
+		c, err := Dial(network, address, opt)
+		if err != nil {
+			_ = p.Close()
+			return nil, err
+		}
+		p.conns = append(p.conns, &pooledConn{c: c, lastUsed: time.Now()})
+	}
+	if popt.HealthCheckInterval > 0 {
+		go p.maintain()
+	}
+	return p, nil
+}
+
+// 当前的连接数
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.conns)
+}
+
+// 选择未完成调用最少的可用连接，必要时新建连接。
+// 没有可用的连接时，如果已经有连接在新建就等它完成，不再另外拨号
+func (p *Pool) get(ctx context.Context) (*pooledConn, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		if p.closed {
+			return nil, ErrShutdown
+		}
+		best := p.pick()
+		if best != nil {
+			if p.popt.MaxPendingPerConn > 0 && best.inflight >= p.popt.MaxPendingPerConn &&
+				len(p.conns)+p.dialing < p.popt.MaxConns {
+				// 所有连接都很忙，后台扩容，这次调用先使用负载最小的连接
+				p.dialing++
+				go p.grow()
+			}
+			best.inflight++
+			best.lastUsed = time.Now()
+			return best, nil
+		}
+		if p.dialing == 0 {
+			// 没有可用的连接也没有正在新建的连接，同步新建一个。
+			// 此时连接数为0，至少允许一个连接
+			return p.dialSync()
+		}
+		// 等正在新建的连接完成
+		done := p.dialDone
+		p.mu.Unlock()
+		select {
+		case <-done:
+		case <-ctx.Done():
+			p.mu.Lock()
+			return nil, ctx.Err()
+		case <-p.closing:
+		}
+		p.mu.Lock()
+		if p.dialing == 0 && p.dialErr != nil && p.pick() == nil && !p.closed {
+			return nil, p.dialErr
+		}
+	}
+}
+
+// 移除已经断开的连接，返回未完成调用最少的连接，调用时需要持有p.mu
+func (p *Pool) pick() *pooledConn {
+	var best *pooledConn
+	kept := p.conns[:0]
+	for _, pc := range p.conns {
+		if !pc.c.IsAvailable() {
+			_ = pc.c.Close()
+			continue
+		}
+		kept = append(kept, pc)
+		if best == nil || pc.inflight < best.inflight {
+			best = pc
+		}
+	}
+	for i := len(kept); i < len(p.conns); i++ {
+		p.conns[i] = nil
+	}
+	p.conns = kept
+	return best
+}
+
+// 在锁外同步拨号，调用时需要持有p.mu
+func (p *Pool) dialSync() (*pooledConn, error) {
+	p.dialing++
+	p.mu.Unlock()
+	c, err := Dial(p.network, p.address, p.opt)
+	p.mu.Lock()
+	pc := p.dialed(c, err)
+	if pc == nil {
+		if err == nil {
+			err = ErrShutdown
+		}
+		return nil, err
+	}
+	pc.inflight++
+	return pc, nil
+}
+
+// 记录一次拨号的结果并唤醒等待的调用，调用时需要持有p.mu
+func (p *Pool) dialed(c *Client, err error) *pooledConn {
+	p.dialing--
+	p.dialErr = err
+	close(p.dialDone)
+	p.dialDone = make(chan struct{})
+	if err != nil {
+		return nil
+	}
+	if p.closed {
+		_ = c.Close()
+		return nil
+	}
+	pc := &pooledConn{c: c, lastUsed: time.Now()}
+	p.conns = append(p.conns, pc)
+	return pc
+}
+
+func (p *Pool) put(pc *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pc.inflight--
+	pc.lastUsed = time.Now()
+}
+
+func (p *Pool) grow() error {
+	c, err := Dial(p.network, p.address, p.opt)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.dialed(c, err)
+	return err
+}
+
+func (p *Pool) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	pc, err := p.get(ctx)
+	if err != nil {
+		return err
+	}
+	defer p.put(pc)
+	return pc.c.Call(ctx, serviceMethod, args, reply)
+}
+
+// 定期做健康检查，移除坏掉的连接，回收空闲连接
+func (p *Pool) maintain() {
+	ticker := time.NewTicker(p.popt.HealthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.closing:
+			return
+		case <-ticker.C:
+		}
+		p.healthCheck()
+		p.shrink()
+		p.fill()
+	}
+}
+
+// 把连接数补到MinConns，连接池关闭或者拨号失败时停止，下一次检查时再试
+func (p *Pool) fill() {
+	for {
+		p.mu.Lock()
+		if p.closed || len(p.conns)+p.dialing >= p.popt.MinConns {
+			p.mu.Unlock()
+			return
+		}
+		p.dialing++
+		p.mu.Unlock()
+		if err := p.grow(); err != nil {
+			return
+		}
+	}
+}
+
+func (p *Pool) healthCheck() {
+	p.mu.Lock()
+	conns := make([]*pooledConn, len(p.conns))
+	copy(conns, p.conns)
+	p.mu.Unlock()
+	for _, pc := range conns {
+		healthy := pc.c.IsAvailable()
+		if healthy && p.popt.HealthCheckMethod != "" {
+			ctx, cancel := context.WithTimeout(context.Background(), p.popt.HealthCheckTimeout)
+			var reply int
+			healthy = pc.c.Call(ctx, p.popt.HealthCheckMethod, 0, &reply) == nil
+			cancel()
+		}
+		if !healthy {
+			p.remove(pc)
+		}
+	}
+}
+
+// 关闭空闲太久的连接，至少保留MinConns个
+func (p *Pool) shrink() {
+	if p.popt.IdleTimeout <= 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	kept := p.conns[:0]
+	n := len(p.conns)
+	for _, pc := range p.conns {
+		if n > p.popt.MinConns && pc.inflight == 0 && time.Since(pc.lastUsed) > p.popt.IdleTimeout {
+			_ = pc.c.Close()
+			n--
+			continue
+		}
+		kept = append(kept, pc)
+	}
+	p.conns = kept
+}
+
+func (p *Pool) remove(target *pooledConn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, pc := range p.conns {
+		if pc == target {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			_ = pc.c.Close()
+			return
+		}
+	}
+}
+
+func (p *Pool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrShutdown
+	}
+	p.closed = true
+	close(p.closing)
+	for _, pc := range p.conns {
+		_ = pc.c.Close()
+	}
+	p.conns = nil
+	return nil
+}
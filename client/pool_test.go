@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+)
+
+func TestPool(t *testing.T) {
+	p, err := NewPool("tcp", newTestServer(t, nil, new(Echo)), &PoolOption{
+		MinConns:            1,
+		MaxConns:            3,
+		MaxPendingPerConn:   1,
+		IdleTimeout:         time.Millisecond * 50,
+		HealthCheckInterval: time.Millisecond * 50,
+		HealthCheckMethod:   "Echo.Echo",
+		HealthCheckTimeout:  time.Second,
+	})
+	_assert(err == nil && p.Len() == 1, "expect 1 connection, got %v", err)
+	defer func() { _ = p.Close() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var reply int
+			err := p.Call(context.Background(), "Echo.Sleep", 100, &reply)
+			_assert(err == nil && reply == 100, "pool call failed: %v", err)
+		}()
+	}
+	time.Sleep(time.Millisecond * 50)
+	_assert(p.Len() > 1 && p.Len() <= 3, "expect the pool to grow, got %d", p.Len())
+	wg.Wait()
+
+	time.Sleep(time.Millisecond * 300)
+	_assert(p.Len() == 1, "expect idle connections to be closed, got %d", p.Len())
+}
+
+// 统计接受的连接数
+type countingListener struct {
+	net.Listener
+	accepted int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err == nil {
+		atomic.AddInt32(&l.accepted, 1)
+	}
+	return conn, err
+}
+
+// 没有可用连接时并发的调用只拨一次号，断开的连接会被移除
+func TestPool_DialOnce(t *testing.T) {
+	s := diyrpc.NewServer()
+	_ = s.Register(new(Echo))
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := &countingListener{Listener: inner}
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	p, err := NewPool("tcp", l.Addr().String(), &PoolOption{MaxConns: 1, MaxPendingPerConn: 1})
+	_assert(err == nil && p.Len() == 0, "expect an empty pool, got %v", err)
+	defer func() { _ = p.Close() }()
+
+	call := func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				var reply int
+				err := p.Call(context.Background(), "Echo.Sleep", 10, &reply)
+				_assert(err == nil && reply == 10, "pool call failed: %v", err)
+			}()
+		}
+		wg.Wait()
+	}
+	call()
+	_assert(atomic.LoadInt32(&l.accepted) == 1 && p.Len() == 1,
+		"expect a single connection, accepted %d, len %d", atomic.LoadInt32(&l.accepted), p.Len())
+
+	p.mu.Lock()
+	_ = p.conns[0].c.Close()
+	p.mu.Unlock()
+	call()
+	_assert(atomic.LoadInt32(&l.accepted) == 2 && p.Len() == 1,
+		"expect the closed connection to be replaced, accepted %d, len %d", atomic.LoadInt32(&l.accepted), p.Len())
+}
+
+// 补充连接时拨号失败或者连接池已经关闭都要停下，等下一次检查
+func TestPool_FillStops(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dead := l.Addr().String()
+	_ = l.Close()
+	popt := &PoolOption{MaxConns: 2}
+	p, err := NewPool("tcp", dead, popt)
+	_assert(err == nil, "new pool failed: %v", err)
+	popt.MinConns = 2
+
+	finished := make(chan struct{})
+	go func() {
+		p.fill()
+		_ = p.Close()
+		p.fill()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+	case <-time.After(2 * time.Second):
+		t.Fatal("fill keeps dialing an unreachable server")
+	}
+	_assert(p.Len() == 0 && p.dialing == 0, "expect no connections, got %d dialing %d", p.Len(), p.dialing)
+}
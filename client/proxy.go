@@ -0,0 +1,144 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+var (
+	typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+	typeOfError   = reflect.TypeOf((*error)(nil)).Elem()
+	typeOfStream  = reflect.TypeOf((*proxyStream)(nil)).Elem()
+)
+
+// 用反射填充proxy中的函数字段，每个字段调用服务中的同名方法，不需要生成代码
+// proxy是指向结构体的指针，字段的签名决定调用方式，ctx可以省略：
+//
+//	Sum    func(ctx context.Context, args Args) (int, error)
+//	Count  func(ctx context.Context, args int) (*client.StreamReader[int], error)
+//	Total  func(ctx context.Context) (*client.StreamWriter[int, int], error)
+//	Echo   func(ctx context.Context) (*client.StreamConn[string, string], error)
+//
+// 标签`rpc:"Name"`指定方法名，`rpc:"-"`跳过这个字段，未公开的字段和非函数字段被忽略
+// 创建时通过diyrpc.DescribeMethod查询服务的方法集合，
+// 方法不存在、流类型或者参数类型不一致时返回错误，而不是在调用时才失败
+func NewProxy(c *Client, serviceName string, proxy interface{}) error {
+	v := reflect.ValueOf(proxy)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return irpc.NewError(irpc.CodeInvalidArgument, "[Client] proxy must be a pointer to struct")
+	}
+	ctx := context.Background()
+	if c.opt.ConnectionTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opt.ConnectionTimeout)
+		defer cancel()
+	}
+	var desc diyrpc.ServiceDesc
+	if err := c.Call(ctx, diyrpc.DescribeMethod, serviceName, &desc); err != nil {
+		return err
+	}
+	methods := make(map[string]*diyrpc.MethodDesc)
+	for i := range desc.Methods {
+		methods[desc.Methods[i].Name] = &desc.Methods[i]
+	}
+
+	v = v.Elem()
+	fns := make(map[int]reflect.Value)
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		name := field.Name
+		if tag := field.Tag.Get("rpc"); tag == "-" || !field.IsExported() || field.Type.Kind() != reflect.Func {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		md := methods[name]
+		if md == nil {
+			return irpc.Errorf(irpc.CodeNotFound, "[Client] proxy field %s: %s has no method %s", field.Name, serviceName, name)
+		}
+		fn, err := c.proxyFunc(field.Type, serviceName+"."+name, md)
+		if err != nil {
+			return irpc.Errorf(irpc.CodeInvalidArgument, "[Client] proxy field %s: %v", field.Name, err)
+		}
+		fns[i] = fn
+	}
+	// 全部校验通过后再填充，失败时不修改proxy
+	for i, fn := range fns {
+		v.Field(i).Set(fn)
+	}
+	return nil
+}
+
+// 根据函数类型生成调用serviceMethod的实现
+func (c *Client) proxyFunc(ft reflect.Type, serviceMethod string, md *diyrpc.MethodDesc) (reflect.Value, error) {
+	if ft.NumOut() != 2 || ft.Out(1) != typeOfError {
+		return reflect.Value{}, fmt.Errorf("must return (result, error)")
+	}
+	hasCtx := ft.NumIn() > 0 && ft.In(0) == typeOfContext
+	argIndex := 0
+	if hasCtx {
+		argIndex = 1
+	}
+	numArgs := ft.NumIn() - argIndex
+	out := ft.Out(0)
+
+	kind := service.Unary
+	if out.Implements(typeOfStream) {
+		kind = reflect.Zero(out).Interface().(proxyStream).streamKind()
+	}
+	if kind != md.Streaming {
+		return reflect.Value{}, fmt.Errorf("%s is %s, the field is %s", serviceMethod, md.Streaming, kind)
+	}
+	switch kind {
+	case service.Unary, service.ServerStreaming:
+		if numArgs != 1 {
+			return reflect.Value{}, fmt.Errorf("must take one argument")
+		}
+		if got := diyrpc.KindOf(ft.In(argIndex)); got != md.ArgKind {
+			return reflect.Value{}, fmt.Errorf("argument is %s, %s takes %s", got, serviceMethod, md.ArgType)
+		}
+	default:
+		if numArgs != 0 {
+			return reflect.Value{}, fmt.Errorf("must take no argument besides ctx")
+		}
+	}
+	if kind == service.Unary {
+		if got := diyrpc.KindOf(out); got != md.ReplyKind {
+			return reflect.Value{}, fmt.Errorf("result is %s, %s returns %s", got, serviceMethod, md.ReplyType)
+		}
+	}
+
+	errValue := func(err error) reflect.Value {
+		v := reflect.New(typeOfError).Elem()
+		if err != nil {
+			v.Set(reflect.ValueOf(err))
+		}
+		return v
+	}
+	return reflect.MakeFunc(ft, func(in []reflect.Value) []reflect.Value {
+		ctx := context.Background()
+		if hasCtx && !in[0].IsNil() {
+			ctx = in[0].Interface().(context.Context)
+		}
+		var args interface{}
+		if numArgs == 1 {
+			args = in[argIndex].Interface()
+		}
+		if kind == service.Unary {
+			reply := reflect.New(out)
+			err := c.Call(ctx, serviceMethod, args, reply.Interface())
+			return []reflect.Value{reply.Elem(), errValue(err)}
+		}
+		ps := reflect.New(out.Elem())
+		st, err := c.openStream(ctx, serviceMethod, args, ps.Interface().(proxyStream).msgFunc())
+		if err != nil {
+			return []reflect.Value{reflect.Zero(out), errValue(err)}
+		}
+		ps.Interface().(proxyStream).bind(st)
+		return []reflect.Value{ps, errValue(nil)}
+	}), nil
+}
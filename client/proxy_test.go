@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"io"
+	"testing"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+type Greeter struct{}
+
+type GreetArgs struct {
+	Name  string
+	Times int
+}
+
+func (g *Greeter) Greet(ctx context.Context, args GreetArgs, reply *string) error {
+	for i := 0; i < args.Times; i++ {
+		*reply += "hello " + args.Name + ";"
+	}
+	return nil
+}
+
+func (g *Greeter) Len(args string, reply *int) error {
+	*reply = len(args)
+	return nil
+}
+
+func (g *Greeter) Letters(args string, stream service.Stream[string]) error {
+	for _, r := range args {
+		if err := stream.Send(string(r)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type GreeterProxy struct {
+	Greet   func(ctx context.Context, args GreetArgs) (string, error)
+	Size    func(args string) (int, error) `rpc:"Len"`
+	Letters func(ctx context.Context, args string) (*StreamReader[string], error)
+	Skipped func() `rpc:"-"`
+}
+
+func TestNewProxy(t *testing.T) {
+	c, _ := Dial("tcp", newTestServer(t, nil, new(Greeter)))
+	defer func() { _ = c.Close() }()
+
+	t.Run("describe", func(t *testing.T) {
+		var desc diyrpc.ServiceDesc
+		err := c.Call(context.Background(), diyrpc.DescribeMethod, "Greeter", &desc)
+		_assert(err == nil && len(desc.Methods) == 3, "expect 3 methods, got %+v %v", desc, err)
+		_assert(desc.Methods[1].Name == "Len" && desc.Methods[1].ArgKind == "string" && desc.Methods[1].ReplyKind == "int",
+			"unexpected method %+v", desc.Methods[1])
+		_assert(desc.Methods[2].Streaming == service.ServerStreaming, "Letters should be server streaming")
+	})
+	t.Run("call", func(t *testing.T) {
+		var p GreeterProxy
+		err := NewProxy(c, "Greeter", &p)
+		_assert(err == nil, "new proxy failed: %v", err)
+		_assert(p.Skipped == nil, "skipped field should stay nil")
+		s, err := p.Greet(context.Background(), GreetArgs{Name: "a", Times: 2})
+		_assert(err == nil && s == "hello a;hello a;", "unexpected greet %q %v", s, err)
+		n, err := p.Size("abc")
+		_assert(err == nil && n == 3, "expect 3, got %d %v", n, err)
+		r, err := p.Letters(context.Background(), "xyz")
+		_assert(err == nil, "open stream failed: %v", err)
+		var got string
+		for {
+			letter, err := r.Recv()
+			if err == io.EOF {
+				break
+			}
+			_assert(err == nil, "recv failed: %v", err)
+			got += letter
+		}
+		_assert(got == "xyz", "expect xyz, got %q", got)
+	})
+	t.Run("validation", func(t *testing.T) {
+		var missing struct {
+			Missing func(ctx context.Context, args int) (int, error)
+		}
+		err := NewProxy(c, "Greeter", &missing)
+		_assert(irpc.CodeOf(err) == irpc.CodeNotFound, "expect NotFound, got %v", err)
+
+		var wrongArg struct {
+			Len func(args int) (int, error)
+		}
+		err = NewProxy(c, "Greeter", &wrongArg)
+		_assert(irpc.CodeOf(err) == irpc.CodeInvalidArgument && wrongArg.Len == nil, "expect InvalidArgument, got %v", err)
+
+		var wrongKind struct {
+			Letters func(args string) (string, error)
+		}
+		err = NewProxy(c, "Greeter", &wrongKind)
+		_assert(irpc.CodeOf(err) == irpc.CodeInvalidArgument, "expect InvalidArgument, got %v", err)
+
+		var p GreeterProxy
+		err = NewProxy(c, "Nobody", &p)
+		_assert(irpc.CodeOf(err) == irpc.CodeNotFound, "expect NotFound for unknown service, got %v", err)
+	})
+}
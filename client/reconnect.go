@@ -0,0 +1,283 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+// 连接状态
+type ConnState int
+
+const (
+	// 还没有开始连接
+	Idle ConnState = iota
+	Connecting
+	Ready
+	// 连接失败或断开，等待重连
+	TransientFailure
+	// 已经关闭，不会再重连
+	Shutdown
+)
+
+func (s ConnState) String() string {
+	switch s {
+	case Idle:
+		return "Idle"
+	case Connecting:
+		return "Connecting"
+	case Ready:
+		return "Ready"
+	case TransientFailure:
+		return "TransientFailure"
+	case Shutdown:
+		return "Shutdown"
+	}
+	return fmt.Sprintf("ConnState(%d)", int(s))
+}
+
+// 连接断开时如何处理还没有返回的调用
+type PendingPolicy int
+
+const (
+	// 直接返回错误
+	FailPending PendingPolicy = iota
+	// 等待重连成功后再发送，直到ctx结束，连接正在关闭时还没有发出的调用也会等待重连。
+	// 已经发出、因为连接断开失败的调用，服务端可能已经执行过，
+	// 只有在ServiceConfig中标记为幂等的方法才会重新发送
+	RequeuePending
+)
+
+type ReconnectOption struct {
+	// 第一次重连前的等待时间
+	InitialBackoff time.Duration
+	// 等待时间的上限
+	MaxBackoff time.Duration
+	// 每次重连失败后等待时间的增长倍数
+	BackoffMultiplier float64
+	// 抖动比例，取值[0,1]
+	Jitter  float64
+	Pending PendingPolicy
+}
+
+var DefaultReconnectOption = &ReconnectOption{
+	InitialBackoff:    time.Millisecond * 100,
+	MaxBackoff:        time.Second * 10,
+	BackoffMultiplier: 1.6,
+	Jitter:            0.2,
+	Pending:           FailPending,
+}
+
+var ErrTransientFailure = irpc.NewError(irpc.CodeUnavailable, "[Client] connection is in transient failure")
+
+// 断线后会自动重连的Client
+// 每次重连都会重新发送Option完成握手
+type ReconnectClient struct {
+	network string
+	address string
+	opt     *diyrpc.Option
+	ropt    *ReconnectOption
+	backoff *RetryPolicy
+
+	mu    sync.Mutex
+	state ConnState
+	// 状态变化时关闭并替换，用来唤醒等待状态变化的goroutine
+	changed chan struct{}
+	c       *Client
+	config  *ServiceConfig
+	closing chan struct{}
+}
+
+// 创建一个ReconnectClient，此时处于Idle状态，
+// 第一次调用Call或Connect时才开始连接
+func NewReconnectClient(network, address string, ropt *ReconnectOption, opts ...*diyrpc.Option) (*ReconnectClient, error) {
+	opt, err := parseOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ropt == nil {
+		ropt = DefaultReconnectOption
+	}
+	return &ReconnectClient{
+		network: network,
+		address: address,
+		opt:     opt,
+		ropt:    ropt,
+		backoff: &RetryPolicy{
+			InitialBackoff:    ropt.InitialBackoff,
+			MaxBackoff:        ropt.MaxBackoff,
+			BackoffMultiplier: ropt.BackoffMultiplier,
+			Jitter:            ropt.Jitter,
+		},
+		state:   Idle,
+		changed: make(chan struct{}),
+		closing: make(chan struct{}),
+	}, nil
+}
+
+func (rc *ReconnectClient) State() ConnState {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return rc.state
+}
+
+// 阻塞直到状态不再是source，状态变化时返回true，ctx结束时返回false
+func (rc *ReconnectClient) WaitForStateChange(ctx context.Context, source ConnState) bool {
+	for {
+		rc.mu.Lock()
+		state, changed := rc.state, rc.changed
+		rc.mu.Unlock()
+		if state != source {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-changed:
+		}
+	}
+}
+
+// 调用时必须持有rc.mu
+func (rc *ReconnectClient) setState(state ConnState) {
+	if rc.state == state || rc.state == Shutdown {
+		return
+	}
+	rc.state = state
+	close(rc.changed)
+	rc.changed = make(chan struct{})
+}
+
+// 从Idle状态开始连接
+func (rc *ReconnectClient) Connect() {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state != Idle {
+		return
+	}
+	rc.setState(Connecting)
+	go rc.run()
+}
+
+func (rc *ReconnectClient) run() {
+	for attempt := 0; ; {
+		c, err := Dial(rc.network, rc.address, rc.opt)
+		rc.mu.Lock()
+		if rc.state == Shutdown {
+			rc.mu.Unlock()
+			if c != nil {
+				_ = c.Close()
+			}
+			return
+		}
+		if err != nil {
+			rc.setState(TransientFailure)
+			rc.mu.Unlock()
+			attempt++
+			select {
+			case <-rc.closing:
+				return
+			case <-time.After(rc.backoff.backoff(attempt)):
+			}
+			rc.mu.Lock()
+			rc.setState(Connecting)
+			rc.mu.Unlock()
+			continue
+		}
+		attempt = 0
+		c.SetServiceConfig(rc.config)
+		rc.c = c
+		rc.setState(Ready)
+		rc.mu.Unlock()
+
+		// Close会关闭当前的Client
+		select {
+		case <-rc.closing:
+			return
+		case <-c.dead:
+		}
+		rc.mu.Lock()
+		rc.setState(TransientFailure)
+		rc.setState(Connecting)
+		rc.mu.Unlock()
+	}
+}
+
+// 等待连接可用
+func (rc *ReconnectClient) ready(ctx context.Context) (*Client, error) {
+	rc.Connect()
+	for {
+		rc.mu.Lock()
+		state, changed, c := rc.state, rc.changed, rc.c
+		rc.mu.Unlock()
+		switch state {
+		case Ready:
+			return c, nil
+		case Shutdown:
+			return nil, ErrShutdown
+		case TransientFailure:
+			if rc.ropt.Pending == FailPending {
+				return nil, ErrTransientFailure
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil, irpc.ContextError(ctx, "[rpc client] call failed")
+		case <-changed:
+		}
+	}
+}
+
+// 设置按方法的调用配置，会应用到当前和之后重连得到的Client上，
+// RequeuePending时只有幂等的方法会在连接断开后重新发送
+func (rc *ReconnectClient) SetServiceConfig(sc *ServiceConfig) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.config = sc
+	if rc.c != nil {
+		rc.c.SetServiceConfig(sc)
+	}
+}
+
+func (rc *ReconnectClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	for {
+		c, err := rc.ready(ctx)
+		if err != nil {
+			return err
+		}
+		err = c.Call(ctx, serviceMethod, args, reply)
+		// 连接断开导致的失败按照策略等待重连后重新发送。ErrShutdown表示调用还没有发出，
+		// 总是可以重新发送，已经发出的调用只有幂等的方法才重新发送
+		if err != nil && rc.ropt.Pending == RequeuePending && !c.IsAvailable() && ctx.Err() == nil &&
+			(errors.Is(err, ErrShutdown) || irpc.CodeOf(err) == irpc.CodeUnavailable && rc.idempotent(serviceMethod)) {
+			continue
+		}
+		return err
+	}
+}
+
+func (rc *ReconnectClient) idempotent(serviceMethod string) bool {
+	rc.mu.Lock()
+	sc := rc.config
+	rc.mu.Unlock()
+	mc := sc.Lookup(serviceMethod)
+	return mc != nil && mc.Idempotent
+}
+
+func (rc *ReconnectClient) Close() error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	if rc.state == Shutdown {
+		return ErrShutdown
+	}
+	rc.setState(Shutdown)
+	close(rc.closing)
+	if rc.c != nil {
+		return rc.c.Close()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+type Echo int
+
+func (e Echo) Echo(args int, reply *int) error {
+	*reply = args
+	return nil
+}
+
+// 睡眠args毫秒
+func (e Echo) Sleep(args int, reply *int) error {
+	time.Sleep(time.Duration(args) * time.Millisecond)
+	*reply = args
+	return nil
+}
+
+func TestReconnectClient(t *testing.T) {
+	rc, err := NewReconnectClient("tcp", newTestServer(t, nil, new(Echo)), &ReconnectOption{
+		InitialBackoff: time.Millisecond * 10,
+		MaxBackoff:     time.Millisecond * 100,
+		Pending:        RequeuePending,
+	})
+	_assert(err == nil && rc.State() == Idle, "expect an idle client")
+	defer func() { _ = rc.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var reply int
+	err = rc.Call(ctx, "Echo.Echo", 1, &reply)
+	_assert(err == nil && reply == 1 && rc.State() == Ready, "first call failed: %v", err)
+
+	// 模拟连接断开
+	rc.mu.Lock()
+	_ = rc.c.cc.Close()
+	rc.mu.Unlock()
+	_assert(rc.WaitForStateChange(ctx, Ready), "expect the state to leave Ready")
+
+	err = rc.Call(ctx, "Echo.Echo", 2, &reply)
+	_assert(err == nil && reply == 2, "call after reconnect failed: %v", err)
+	_assert(rc.State() == Ready, "expect Ready after reconnect, got %s", rc.State())
+
+	_ = rc.Close()
+	_assert(rc.State() == Shutdown && rc.Call(ctx, "Echo.Echo", 3, &reply) == ErrShutdown, "expect shutdown")
+}
+
+// 连接断开时已经发出的调用只有幂等的方法会在重连后重新发送
+func TestReconnectClient_RequeueIdempotentOnly(t *testing.T) {
+	addr := newTestServer(t, nil, new(Echo))
+	rc, err := NewReconnectClient("tcp", addr, &ReconnectOption{
+		InitialBackoff: time.Millisecond * 10,
+		MaxBackoff:     time.Millisecond * 100,
+		Pending:        RequeuePending,
+	})
+	_assert(err == nil, "new reconnect client failed: %v", err)
+	defer func() { _ = rc.Close() }()
+	rc.SetServiceConfig(&ServiceConfig{Methods: map[string]*MethodConfig{
+		"Echo.Echo": {Idempotent: true},
+	}})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	var reply int
+	_assert(rc.Call(ctx, "Echo.Echo", 1, &reply) == nil, "first call failed")
+
+	// 在调用进行中断开连接
+	inflight := func(serviceMethod string) error {
+		errc := make(chan error, 1)
+		go func() {
+			var reply int
+			errc <- rc.Call(ctx, serviceMethod, 200, &reply)
+		}()
+		time.Sleep(time.Millisecond * 50)
+		rc.mu.Lock()
+		_ = rc.c.cc.Close()
+		rc.mu.Unlock()
+		return <-errc
+	}
+	err = inflight("Echo.Sleep")
+	_assert(irpc.CodeOf(err) == irpc.CodeUnavailable, "a non-idempotent call should not be resent, got %v", err)
+
+	// 连接正在关闭时还没有发出的调用等待重连后发送，和是否幂等无关
+	_assert(rc.Call(ctx, "Echo.Sleep", 1, &reply) == nil, "call after reconnect failed")
+	rc.mu.Lock()
+	old := rc.c
+	rc.mu.Unlock()
+	_ = old.Close()
+	err = rc.Call(ctx, "Echo.Sleep", 3, &reply)
+	_assert(err == nil && reply == 3, "an unsent call should wait for the reconnect, got %v", err)
+	_assert(rc.Call(ctx, "Echo.Echo", 2, &reply) == nil && reply == 2, "call after reconnect failed")
+
+	rc.SetServiceConfig(&ServiceConfig{Methods: map[string]*MethodConfig{
+		"Echo.*": {Idempotent: true},
+	}})
+	err = inflight("Echo.Sleep")
+	_assert(err == nil, "an idempotent call should be resent after reconnecting, got %v", err)
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 描述一个方法调用失败后如何重试
+type RetryPolicy struct {
+	// 最多尝试的次数（包括第一次），小于2表示不重试
+	MaxAttempts int
+	// 第一次重试前的等待时间
+	InitialBackoff time.Duration
+	// 等待时间的上限
+	MaxBackoff time.Duration
+	// 每次重试等待时间的增长倍数
+	BackoffMultiplier float64
+	// 抖动比例，取值[0,1]，实际等待时间在backoff*(1±Jitter)之间随机
+	Jitter float64
+	// 可以重试的错误码
+	RetryableCodes []irpc.Code
+}
+
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:       3,
+	InitialBackoff:    time.Millisecond * 100,
+	MaxBackoff:        time.Second * 2,
+	BackoffMultiplier: 2,
+	Jitter:            0.2,
+	RetryableCodes:    []irpc.Code{irpc.CodeUnavailable},
+}
+
+// 第attempt次重试前需要等待的时间，attempt从1开始
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.BackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d = d * (1 + p.Jitter*(rand.Float64()*2-1))
+	}
+	return time.Duration(d)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	code := irpc.CodeOf(err)
+	for _, c := range p.RetryableCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// 对冲请求策略：调用在Delay后还没有完成，就向另一个实例再发一次，
+// 取最先成功的结果，其余的取消
+type HedgingPolicy struct {
+	// 最多同时发出的请求数（包括第一次）
+	MaxAttempts int
+	// 发出下一个对冲请求前等待的时间
+	Delay time.Duration
+	// 为true时使用观测到的p95延迟代替Delay，样本不足时仍使用Delay
+	UseP95 bool
+	// 失败后可以继续对冲的错误码，为空时使用DefaultRetryPolicy.RetryableCodes，
+	// 其他错误码直接作为调用的结果返回
+	RetryableCodes []irpc.Code
+}
+
+// 出错的对冲请求是否可以由其他请求继续尝试
+func (p *HedgingPolicy) Retryable(err error) bool {
+	codes := p.RetryableCodes
+	if len(codes) == 0 {
+		codes = DefaultRetryPolicy.RetryableCodes
+	}
+	return (&RetryPolicy{RetryableCodes: codes}).retryable(err)
+}
+
+// 单个方法的调用配置
+type MethodConfig struct {
+	// 只有幂等的方法才会被重试或对冲
+	Idempotent bool
+	Retry      *RetryPolicy
+	// 同时配置了Retry和Hedging时，Hedging优先
+	Hedging *HedgingPolicy
+}
+
+// 按方法配置调用行为
+// Methods的key可以是"Service.Method"，"Service.*"匹配整个服务，"*"匹配所有方法
+type ServiceConfig struct {
+	Methods map[string]*MethodConfig
+	// 重试预算，为空时不限制重试
+	Budget *RetryBudget
+}
+
+// 查找serviceMethod对应的配置，没有时返回nil
+func (sc *ServiceConfig) Lookup(serviceMethod string) *MethodConfig {
+	if sc == nil {
+		return nil
+	}
+	if mc, ok := sc.Methods[serviceMethod]; ok {
+		return mc
+	}
+	if dot := strings.LastIndex(serviceMethod, "."); dot >= 0 {
+		if mc, ok := sc.Methods[serviceMethod[:dot]+".*"]; ok {
+			return mc
+		}
+	}
+	return sc.Methods["*"]
+}
+
+// 执行一次调用，如果serviceMethod是幂等的并且配置了重试策略，
+// 失败时按照策略重试，attempt是第几次尝试，从0开始
+// sc为nil时只调用一次
+// 熔断器打开(ErrBreakerOpen)时重试也会被拒绝，直接返回，不消耗重试预算
+func (sc *ServiceConfig) Do(ctx context.Context, serviceMethod string, attempt func(attempt int) error) error {
+	mc := sc.Lookup(serviceMethod)
+	if mc == nil || !mc.Idempotent || mc.Retry == nil || mc.Retry.MaxAttempts < 2 {
+		return attempt(0)
+	}
+	policy := mc.Retry
+	var err error
+	for i := 0; ; i++ {
+		err = attempt(i)
+		if err == nil {
+			sc.Budget.onSuccess()
+			return nil
+		}
+		if errors.Is(err, ErrBreakerOpen) || !policy.retryable(err) {
+			return err
+		}
+		sc.Budget.onFailure()
+		if i+1 >= policy.MaxAttempts || !sc.Budget.allow() {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(policy.backoff(i + 1)):
+		}
+	}
+}
+
+// 限制重试的比例，防止后端故障时重试把流量放大
+// 每次失败消耗1个token，每次成功归还Ratio个token，
+// token不足MaxTokens的一半时不再重试
+type RetryBudget struct {
+	mu        sync.Mutex
+	maxTokens float64
+	ratio     float64
+	tokens    float64
+}
+
+func NewRetryBudget(maxTokens, ratio float64) *RetryBudget {
+	return &RetryBudget{
+		maxTokens: maxTokens,
+		ratio:     ratio,
+		tokens:    maxTokens,
+	}
+}
+
+func (b *RetryBudget) onSuccess() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Min(b.tokens+b.ratio, b.maxTokens)
+}
+
+func (b *RetryBudget) onFailure() {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tokens = math.Max(b.tokens-1, 0)
+}
+
+func (b *RetryBudget) allow() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens > b.maxTokens/2
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+func TestServiceConfig_Do(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:       3,
+		InitialBackoff:    time.Millisecond,
+		BackoffMultiplier: 2,
+		RetryableCodes:    []irpc.Code{irpc.CodeUnavailable},
+	}
+	sc := &ServiceConfig{Methods: map[string]*MethodConfig{
+		"Foo.Get": {Idempotent: true, Retry: policy},
+		"Foo.Set": {Idempotent: false, Retry: policy},
+	}}
+	unavailable := irpc.NewError(irpc.CodeUnavailable, "unavailable")
+	t.Run("idempotent", func(t *testing.T) {
+		n := 0
+		err := sc.Do(context.Background(), "Foo.Get", func(attempt int) error {
+			n++
+			if attempt < 2 {
+				return unavailable
+			}
+			return nil
+		})
+		_assert(err == nil && n == 3, "expect success on the third attempt, got %d attempts", n)
+	})
+	t.Run("not idempotent", func(t *testing.T) {
+		n := 0
+		err := sc.Do(context.Background(), "Foo.Set", func(attempt int) error {
+			n++
+			return unavailable
+		})
+		_assert(err == unavailable && n == 1, "non-idempotent method should not retry")
+	})
+	t.Run("not retryable", func(t *testing.T) {
+		n := 0
+		err := sc.Do(context.Background(), "Foo.Get", func(attempt int) error {
+			n++
+			return errors.New("handler error")
+		})
+		_assert(err != nil && n == 1, "only retryable codes should retry")
+	})
+	t.Run("budget", func(t *testing.T) {
+		budget := &ServiceConfig{Methods: sc.Methods, Budget: NewRetryBudget(2, 0.1)}
+		n := 0
+		_ = budget.Do(context.Background(), "Foo.Get", func(attempt int) error {
+			n++
+			return unavailable
+		})
+		_assert(n == 1, "retry budget exhausted, expect 1 attempt but got %d", n)
+	})
+}
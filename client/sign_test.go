@@ -0,0 +1,140 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+func TestSigning(t *testing.T) {
+	k1, k2 := []byte("first secret"), []byte("second secret")
+	var s *diyrpc.Server
+	addr := newTestServer(t, func(srv *diyrpc.Server) {
+		s = srv
+		s.SetSigning(&diyrpc.Signing{Keys: map[string][]byte{"k1": k1}, MaxSkew: time.Minute})
+	}, new(Greeter))
+
+	dial := func(t *testing.T, key *code.SigningKey) *Client {
+		c, err := Dial("tcp", addr, &diyrpc.Option{SigningKey: key})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = c.Close() })
+		return c
+	}
+	length := func(c *Client, s string) (int, error) {
+		var n int
+		err := c.Call(context.Background(), "Greeter.Len", s, &n)
+		return n, err
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		c := dial(t, &code.SigningKey{ID: "k1", Secret: k1})
+		if n, err := length(c, "hello"); err != nil || n != 5 {
+			t.Fatalf("got %d, %v", n, err)
+		}
+	})
+	t.Run("unsigned", func(t *testing.T) {
+		c := dial(t, nil)
+		if _, err := length(c, "hello"); irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect Unauthenticated, got %v", err)
+		}
+	})
+	t.Run("wrong secret", func(t *testing.T) {
+		c := dial(t, &code.SigningKey{ID: "k1", Secret: k2})
+		if _, err := length(c, "hello"); irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect Unauthenticated, got %v", err)
+		}
+		// 只拒绝这个请求，连接仍然可用
+		if !c.IsAvailable() {
+			t.Fatal("connection should stay open")
+		}
+	})
+	t.Run("rotation", func(t *testing.T) {
+		old := dial(t, &code.SigningKey{ID: "k1", Secret: k1})
+		s.SetSigning(&diyrpc.Signing{Keys: map[string][]byte{"k1": k1, "k2": k2}, MaxSkew: time.Minute})
+		next := dial(t, &code.SigningKey{ID: "k2", Secret: k2})
+		if _, err := length(old, "a"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := length(next, "a"); err != nil {
+			t.Fatal(err)
+		}
+		s.SetSigning(&diyrpc.Signing{Keys: map[string][]byte{"k2": k2}, MaxSkew: time.Minute})
+		if _, err := length(old, "a"); irpc.CodeOf(err) != irpc.CodeUnauthenticated {
+			t.Fatalf("expect the retired key to be rejected, got %v", err)
+		}
+		if _, err := length(next, "a"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		c := dial(t, &code.SigningKey{ID: "k2", Secret: k2})
+		r, err := ServerStream[string](context.Background(), c, "Greeter.Letters", "abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		for {
+			msg, err := r.Recv()
+			if err != nil {
+				break
+			}
+			got += msg
+		}
+		if got != "abc" {
+			t.Fatalf("got %q", got)
+		}
+	})
+
+	t.Run("tampered, stale and replayed", func(t *testing.T) {
+		// 直接写连接，构造各种签名消息
+		conn := rawDial(t, addr)
+		cc := code.NewGobCode(conn)
+		signed := func(seq uint64, args string, ts time.Time, nonce string) (*irpc.Header, []byte) {
+			raw, _ := cc.EncodeValue(args)
+			h := &irpc.Header{ServiceMethod: "Greeter.Len", Seq: seq, Sign: &irpc.Signature{
+				KeyID: "k2", Timestamp: ts.UnixNano(), Nonce: []byte(nonce),
+			}}
+			h.Sign.MAC = irpc.SignMAC(k2, h, raw)
+			return h, raw
+		}
+		expect := func(seq uint64, code irpc.Code) {
+			t.Helper()
+			var h irpc.Header
+			var n int
+			if err := cc.ReadHeader(&h); err != nil {
+				t.Fatal(err)
+			}
+			_ = cc.ReadBody(&n)
+			if h.Seq != seq || h.Code != code {
+				t.Fatalf("seq %d: expect %s, got seq %d %s %q", seq, code, h.Seq, h.Code, h.Error)
+			}
+		}
+
+		h, raw := signed(1, "abc", time.Now(), "n1")
+		_ = cc.Write(h, raw)
+		expect(1, irpc.CodeOK)
+		// 同一个nonce再发一次
+		_ = cc.Write(h, raw)
+		expect(1, irpc.CodeUnauthenticated)
+
+		h, _ = signed(2, "abc", time.Now(), "n2")
+		tampered, _ := cc.EncodeValue("abcdef")
+		_ = cc.Write(h, tampered)
+		expect(2, irpc.CodeUnauthenticated)
+
+		h, raw = signed(3, "abc", time.Now().Add(-time.Hour), "n3")
+		_ = cc.Write(h, raw)
+		expect(3, irpc.CodeUnauthenticated)
+
+		h, raw = signed(4, "abc", time.Now(), "n4")
+		h.ServiceMethod = "Greeter.Greet"
+		_ = cc.Write(h, raw)
+		expect(4, irpc.CodeUnauthenticated)
+	})
+}
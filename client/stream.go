@@ -0,0 +1,414 @@
+package client
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+// 一个流在客户端的状态
+type stream struct {
+	c      *Client
+	seq    uint64
+	method string
+	newMsg func() interface{}
+	// 容量等于窗口大小，服务端遵守流控时接收协程不会阻塞
+	msgs   chan interface{}
+	window uint32
+
+	mu sync.Mutex
+	// 已经被Recv取走、还没有告诉服务端的消息数
+	consumed uint32
+	err      error
+	done     chan struct{}
+	// 还能向服务端发送的消息数，窗口增加时关闭并替换granted
+	credits uint32
+	granted chan struct{}
+	// 已经关闭发送
+	sendClosed bool
+	// 流结束时记录指标，只有第一次调用生效
+	record func(irpc.Code)
+}
+
+// 结束流，只有第一次调用生效
+func (st *stream) finish(err error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.err != nil {
+		return
+	}
+	st.err = err
+	close(st.done)
+	if err == io.EOF {
+		err = nil
+	}
+	st.record(irpc.CodeOf(err))
+}
+
+func (st *stream) recv() (interface{}, error) {
+	var msg interface{}
+	select {
+	case msg = <-st.msgs:
+	case <-st.done:
+		// 结束前收到的消息要先交给调用方
+		select {
+		case msg = <-st.msgs:
+		default:
+			st.mu.Lock()
+			defer st.mu.Unlock()
+			return nil, st.err
+		}
+	}
+	st.mu.Lock()
+	st.consumed++
+	var n uint32
+	if st.consumed >= st.window/2 || st.consumed == st.window {
+		n, st.consumed = st.consumed, 0
+	}
+	st.mu.Unlock()
+	if n > 0 {
+		st.c.sendControl(&irpc.Header{Seq: st.seq, Kind: irpc.KindWindowUpdate, Window: n})
+	}
+	return msg, nil
+}
+
+// 向服务端发送一条消息，窗口用完时阻塞
+func (st *stream) send(msg interface{}) error {
+	for {
+		st.mu.Lock()
+		if st.err != nil {
+			err := st.err
+			st.mu.Unlock()
+			return err
+		}
+		if st.sendClosed {
+			st.mu.Unlock()
+			return errSendClosed
+		}
+		if st.credits > 0 {
+			st.credits--
+			st.mu.Unlock()
+			break
+		}
+		granted := st.granted
+		st.mu.Unlock()
+		select {
+		case <-st.done:
+		case <-granted:
+		}
+	}
+	return st.c.write(&irpc.Header{ServiceMethod: st.method, Seq: st.seq, Kind: irpc.KindStreamMsg}, msg)
+}
+
+var errSendClosed = irpc.NewError(irpc.CodeInvalidArgument, "[Client] send on a closed stream")
+
+// 关闭发送，服务端的Recv会返回io.EOF
+func (st *stream) closeSend() error {
+	st.mu.Lock()
+	if st.sendClosed {
+		st.mu.Unlock()
+		return nil
+	}
+	st.sendClosed = true
+	st.mu.Unlock()
+	return st.c.write(&irpc.Header{ServiceMethod: st.method, Seq: st.seq, Kind: irpc.KindStreamEnd}, struct{}{})
+}
+
+func (st *stream) grant(n uint32) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.credits += n
+	close(st.granted)
+	st.granted = make(chan struct{})
+}
+
+// 调用方放弃了流，通知服务端取消
+func (st *stream) cancel(err error) {
+	if st.c.removeStream(st.seq) != nil {
+		go st.c.sendCancel(st.seq)
+	}
+	st.finish(err)
+}
+
+func (c *Client) removeStream(seq uint64) *stream {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.streams[seq]
+	delete(c.streams, seq)
+	return st
+}
+
+// 处理KindStreamMsg、KindStreamEnd和KindWindowUpdate，返回读body的错误
+func (c *Client) receiveStream(h *irpc.Header) error {
+	if h.Kind == irpc.KindWindowUpdate {
+		c.mu.Lock()
+		st := c.streams[h.Seq]
+		c.mu.Unlock()
+		if st != nil {
+			st.grant(h.Window)
+		}
+		return c.cc.ReadBody(nil)
+	}
+	if h.Kind == irpc.KindStreamEnd {
+		st := c.removeStream(h.Seq)
+		if err := c.cc.ReadBody(nil); err != nil {
+			return err
+		}
+		if st != nil {
+			if h.Error != "" {
+				st.finish(irpc.HeaderError(h))
+			} else {
+				st.finish(io.EOF)
+			}
+		}
+		return nil
+	}
+	c.mu.Lock()
+	st := c.streams[h.Seq]
+	c.mu.Unlock()
+	if st == nil {
+		return c.cc.ReadBody(nil)
+	}
+	msg := st.newMsg()
+	if err := c.cc.ReadBody(msg); err != nil {
+		return err
+	}
+	select {
+	case st.msgs <- msg:
+	default:
+		// 服务端没有遵守流控
+		st.cancel(irpc.NewError(irpc.CodeResourceExhausted, "[Client] stream window exceeded"))
+	}
+	return nil
+}
+
+// 发起流调用，请求的Window是流控的初始窗口
+// 客户端流和双向流没有args，请求的body为空
+func (c *Client) openStream(ctx context.Context, serviceMethod string, args interface{}, newMsg func() interface{}) (*stream, error) {
+	if ctx.Err() != nil {
+		return nil, irpc.ContextError(ctx, "[rpc client] call failed")
+	}
+	if args == nil {
+		args = struct{}{}
+	}
+	window := uint32(diyrpc.DefaultStreamWindow)
+	st := &stream{
+		c:       c,
+		method:  serviceMethod,
+		newMsg:  newMsg,
+		msgs:    make(chan interface{}, window),
+		window:  window,
+		done:    make(chan struct{}),
+		credits: diyrpc.DefaultStreamWindow,
+		granted: make(chan struct{}),
+		record:  c.opt.Metrics.Start(serviceMethod),
+	}
+	c.sending.Lock()
+	c.mu.Lock()
+	if c.closing || c.shutdown {
+		c.mu.Unlock()
+		c.sending.Unlock()
+		st.finish(ErrShutdown)
+		return nil, ErrShutdown
+	}
+	st.seq = c.seq
+	c.seq++
+	c.streams[st.seq] = st
+	c.mu.Unlock()
+	h := &irpc.Header{
+		ServiceMethod: serviceMethod,
+		Seq:           st.seq,
+		Kind:          irpc.KindCall,
+		Timeout:       timeoutOf(ctx),
+		Window:        window,
+	}
+	err := c.cc.Write(h, args)
+	c.sending.Unlock()
+	if err != nil {
+		c.removeStream(st.seq)
+		err = irpc.NewError(irpc.CodeUnavailable, err.Error())
+		st.finish(err)
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			st.cancel(irpc.ContextError(ctx, "[rpc client] call failed"))
+		case <-st.done:
+		}
+	}()
+	return st, nil
+}
+
+// 接收服务端流的消息
+type StreamReader[T any] struct {
+	st        *stream
+	closeOnce sync.Once
+	closed    chan struct{}
+}
+
+// 调用服务端流方法，方法签名为 func (t *T) M(args, stream service.Stream[T]) error
+// ctx结束时流被取消
+func ServerStream[T any](ctx context.Context, c *Client, serviceMethod string, args interface{}) (*StreamReader[T], error) {
+	st, err := c.openStream(ctx, serviceMethod, args, newMsgFunc[T]())
+	if err != nil {
+		return nil, err
+	}
+	return &StreamReader[T]{st: st, closed: make(chan struct{})}, nil
+}
+
+// 接收下一条消息，流正常结束时返回io.EOF
+func (r *StreamReader[T]) Recv() (T, error) {
+	return recvMsg[T](r.st)
+}
+
+// 以channel的形式接收消息，流结束时channel被关闭，之后通过Err获取流的错误
+func (r *StreamReader[T]) Chan() <-chan T {
+	ch := make(chan T)
+	go func() {
+		defer close(ch)
+		for {
+			msg, err := r.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- msg:
+			case <-r.closed:
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+// 流正常结束时返回nil，还没有结束时也返回nil
+func (r *StreamReader[T]) Err() error {
+	r.st.mu.Lock()
+	defer r.st.mu.Unlock()
+	if r.st.err == io.EOF {
+		return nil
+	}
+	return r.st.err
+}
+
+// 提前结束流，通知服务端取消
+func (r *StreamReader[T]) Close() {
+	r.closeOnce.Do(func() {
+		close(r.closed)
+		r.st.cancel(ErrCanceled)
+	})
+}
+
+func newMsgFunc[T any]() func() interface{} {
+	msgType := reflect.TypeOf((*T)(nil)).Elem()
+	return func() interface{} {
+		return reflect.New(msgType).Interface()
+	}
+}
+
+func recvMsg[T any](st *stream) (T, error) {
+	var zero T
+	msg, err := st.recv()
+	if err != nil {
+		return zero, err
+	}
+	return *msg.(*T), nil
+}
+
+// 向客户端流方法发送消息
+type StreamWriter[Req, Reply any] struct {
+	st *stream
+}
+
+// 调用客户端流方法，方法签名为
+// func (t *T) M(stream service.ClientStream[Req], reply *Reply) error
+func ClientStream[Req, Reply any](ctx context.Context, c *Client, serviceMethod string) (*StreamWriter[Req, Reply], error) {
+	st, err := c.openStream(ctx, serviceMethod, nil, newMsgFunc[Reply]())
+	if err != nil {
+		return nil, err
+	}
+	return &StreamWriter[Req, Reply]{st: st}, nil
+}
+
+// 发送一条消息，服务端的窗口用完时阻塞
+func (w *StreamWriter[Req, Reply]) Send(msg Req) error {
+	return w.st.send(msg)
+}
+
+// 关闭发送并等待服务端的reply
+func (w *StreamWriter[Req, Reply]) CloseAndRecv() (Reply, error) {
+	var zero Reply
+	if err := w.st.closeSend(); err != nil {
+		return zero, err
+	}
+	reply, err := recvMsg[Reply](w.st)
+	if err == io.EOF {
+		return zero, irpc.NewError(irpc.CodeInternal, "[Client] stream ended without reply")
+	}
+	return reply, err
+}
+
+// 放弃这个流，通知服务端取消
+func (w *StreamWriter[Req, Reply]) Close() {
+	w.st.cancel(ErrCanceled)
+}
+
+// 双向流
+type StreamConn[Req, Reply any] struct {
+	st *stream
+}
+
+// 调用双向流方法，方法签名为
+// func (t *T) M(stream service.BidiStream[Req, Reply]) error
+func BidiStream[Req, Reply any](ctx context.Context, c *Client, serviceMethod string) (*StreamConn[Req, Reply], error) {
+	st, err := c.openStream(ctx, serviceMethod, nil, newMsgFunc[Reply]())
+	if err != nil {
+		return nil, err
+	}
+	return &StreamConn[Req, Reply]{st: st}, nil
+}
+
+func (s *StreamConn[Req, Reply]) Send(msg Req) error {
+	return s.st.send(msg)
+}
+
+// 接收下一条消息，流正常结束时返回io.EOF
+func (s *StreamConn[Req, Reply]) Recv() (Reply, error) {
+	return recvMsg[Reply](s.st)
+}
+
+// 关闭发送，之后仍然可以Recv
+func (s *StreamConn[Req, Reply]) CloseSend() error {
+	return s.st.closeSend()
+}
+
+// 放弃这个流，通知服务端取消
+func (s *StreamConn[Req, Reply]) Close() {
+	s.st.cancel(ErrCanceled)
+}
+
+// 代理通过这个接口创建流的返回值，见proxy.go
+type proxyStream interface {
+	streamKind() service.StreamKind
+	msgFunc() func() interface{}
+	bind(st *stream)
+}
+
+func (*StreamReader[T]) streamKind() service.StreamKind { return service.ServerStreaming }
+func (*StreamReader[T]) msgFunc() func() interface{}    { return newMsgFunc[T]() }
+func (r *StreamReader[T]) bind(st *stream) {
+	r.st, r.closed = st, make(chan struct{})
+}
+
+func (*StreamWriter[Req, Reply]) streamKind() service.StreamKind { return service.ClientStreaming }
+func (*StreamWriter[Req, Reply]) msgFunc() func() interface{}    { return newMsgFunc[Reply]() }
+func (w *StreamWriter[Req, Reply]) bind(st *stream)              { w.st = st }
+
+func (*StreamConn[Req, Reply]) streamKind() service.StreamKind { return service.BidiStreaming }
+func (*StreamConn[Req, Reply]) msgFunc() func() interface{}    { return newMsgFunc[Reply]() }
+func (s *StreamConn[Req, Reply]) bind(st *stream)              { s.st = st }
@@ -0,0 +1,174 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/service"
+)
+
+type Counter struct {
+	sent int64
+}
+
+// 依次发送0到n-1
+func (c *Counter) Count(n int, stream service.Stream[int]) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+		atomic.AddInt64(&c.sent, 1)
+	}
+	return nil
+}
+
+func (c *Counter) Fail(n int, stream service.Stream[int]) error {
+	for i := 0; i < n; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return errors.New("count failed")
+}
+
+func TestServerStream(t *testing.T) {
+	counter := new(Counter)
+	c, _ := Dial("tcp", newTestServer(t, nil, counter))
+	defer func() { _ = c.Close() }()
+
+	t.Run("flow control", func(t *testing.T) {
+		r, err := ServerStream[int](context.Background(), c, "Counter.Count", 100)
+		_assert(err == nil, "open stream failed: %v", err)
+		time.Sleep(time.Millisecond * 200)
+		sent := atomic.LoadInt64(&counter.sent)
+		_assert(sent == diyrpc.DefaultStreamWindow, "expect the server to stop at the window, sent %d", sent)
+		for i := 0; i < 100; i++ {
+			msg, err := r.Recv()
+			_assert(err == nil && msg == i, "expect %d, got %d %v", i, msg, err)
+		}
+		_, err = r.Recv()
+		_assert(err == io.EOF, "expect io.EOF at the end of stream, got %v", err)
+	})
+	t.Run("error", func(t *testing.T) {
+		r, _ := ServerStream[int](context.Background(), c, "Counter.Fail", 3)
+		n := 0
+		for range r.Chan() {
+			n++
+		}
+		_assert(n == 3 && r.Err() != nil && strings.Contains(r.Err().Error(), "count failed"),
+			"expect 3 messages and the handler error, got %d %v", n, r.Err())
+	})
+	t.Run("close", func(t *testing.T) {
+		r, _ := ServerStream[int](context.Background(), c, "Counter.Count", 1000)
+		_, _ = r.Recv()
+		r.Close()
+		_, err := r.Recv()
+		for err == nil {
+			_, err = r.Recv()
+		}
+		_assert(err == ErrCanceled, "expect ErrCanceled after Close, got %v", err)
+	})
+}
+
+type Summer struct {
+	received int64
+}
+
+// 累加客户端发来的所有数
+func (s *Summer) Sum(stream service.ClientStream[int], reply *int) error {
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*reply += n
+	}
+}
+
+// 等待一段时间后才开始接收，用来验证客户端的流控
+func (s *Summer) SlowSum(stream service.ClientStream[int], reply *int) error {
+	time.Sleep(time.Millisecond * 200)
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		atomic.AddInt64(&s.received, 1)
+		*reply += n
+	}
+}
+
+// 把收到的每个数乘2返回
+func (s *Summer) Double(stream service.BidiStream[int, int]) error {
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(n * 2); err != nil {
+			return err
+		}
+	}
+}
+
+func TestClientAndBidiStream(t *testing.T) {
+	summer := new(Summer)
+	c, _ := Dial("tcp", newTestServer(t, nil, summer))
+	defer func() { _ = c.Close() }()
+
+	t.Run("client stream", func(t *testing.T) {
+		w, err := ClientStream[int, int](context.Background(), c, "Summer.Sum")
+		_assert(err == nil, "open stream failed: %v", err)
+		for i := 1; i <= 100; i++ {
+			_assert(w.Send(i) == nil, "send %d failed", i)
+		}
+		sum, err := w.CloseAndRecv()
+		_assert(err == nil && sum == 5050, "expect 5050, got %d %v", sum, err)
+	})
+	t.Run("client flow control", func(t *testing.T) {
+		w, _ := ClientStream[int, int](context.Background(), c, "Summer.SlowSum")
+		var sent int64
+		go func() {
+			for i := 0; i < 100; i++ {
+				if w.Send(1) != nil {
+					return
+				}
+				atomic.AddInt64(&sent, 1)
+			}
+		}()
+		time.Sleep(time.Millisecond * 100)
+		n := atomic.LoadInt64(&sent)
+		_assert(n == diyrpc.DefaultStreamWindow, "expect the client to stop at the window, sent %d", n)
+		for atomic.LoadInt64(&sent) < 100 {
+			time.Sleep(time.Millisecond * 10)
+		}
+		sum, err := w.CloseAndRecv()
+		_assert(err == nil && sum == 100, "expect 100, got %d %v", sum, err)
+	})
+	t.Run("bidi stream", func(t *testing.T) {
+		conn, err := BidiStream[int, int](context.Background(), c, "Summer.Double")
+		_assert(err == nil, "open stream failed: %v", err)
+		for i := 0; i < 50; i++ {
+			_assert(conn.Send(i) == nil, "send %d failed", i)
+			n, err := conn.Recv()
+			_assert(err == nil && n == i*2, "expect %d, got %d %v", i*2, n, err)
+		}
+		_assert(conn.CloseSend() == nil, "close send failed")
+		_, err = conn.Recv()
+		_assert(err == io.EOF, "expect io.EOF after close send, got %v", err)
+	})
+}
@@ -0,0 +1,17 @@
+package client
+
+import (
+	"crypto/tls"
+	"net"
+)
+
+// 用TLS包装连接，配置中没有ServerName时使用地址中的主机名校验服务端证书
+func tlsClient(conn net.Conn, address string, cfg *tls.Config) *tls.Conn {
+	if cfg.ServerName == "" && !cfg.InsecureSkipVerify {
+		if host, _, err := net.SplitHostPort(address); err == nil {
+			cfg = cfg.Clone()
+			cfg.ServerName = host
+		}
+	}
+	return tls.Client(conn, cfg)
+}
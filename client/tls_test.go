@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/tlstest"
+)
+
+func startTLSServer(t *testing.T, cfg *tls.Config, a diyrpc.Authenticator) string {
+	return newTestServer(t, func(s *diyrpc.Server) {
+		s.SetTLSConfig(cfg)
+		s.SetAuthenticator(a)
+	}, new(Whoami))
+}
+
+func TestTLS(t *testing.T) {
+	ca, err := tlstest.NewCA("test ca")
+	if err != nil {
+		t.Fatal(err)
+	}
+	me := func(c *Client) (string, error) {
+		var reply string
+		err := c.Call(context.Background(), "Whoami.Me", struct{}{}, &reply)
+		return reply, err
+	}
+
+	t.Run("server only", func(t *testing.T) {
+		serverCfg, _ := ca.ServerConfig(false, "127.0.0.1")
+		addr := startTLSServer(t, serverCfg, nil)
+		clientCfg, _ := ca.ClientConfig("")
+		c, err := Dial("tcp", addr, &diyrpc.Option{TLSConfig: clientCfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if got, err := me(c); err != nil || got != "" {
+			t.Fatalf("expect anonymous caller, got %q, %v", got, err)
+		}
+	})
+	t.Run("untrusted server", func(t *testing.T) {
+		other, _ := tlstest.NewCA("other ca")
+		serverCfg, _ := other.ServerConfig(false, "127.0.0.1")
+		addr := startTLSServer(t, serverCfg, nil)
+		clientCfg, _ := ca.ClientConfig("")
+		if _, err := Dial("tcp", addr, &diyrpc.Option{TLSConfig: clientCfg}); err == nil {
+			t.Fatal("expect certificate verification to fail")
+		}
+	})
+
+	serverCfg, _ := ca.ServerConfig(true, "127.0.0.1")
+	addr := startTLSServer(t, serverCfg, nil)
+	t.Run("mutual", func(t *testing.T) {
+		clientCfg, _ := ca.ClientConfig("carol")
+		c, err := Dial("tcp", addr, &diyrpc.Option{TLSConfig: clientCfg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if got, err := me(c); err != nil || got != "tls:carol" {
+			t.Fatalf("identity %q, %v", got, err)
+		}
+	})
+	t.Run("no client cert", func(t *testing.T) {
+		clientCfg, _ := ca.ClientConfig("")
+		c, err := Dial("tcp", addr, &diyrpc.Option{TLSConfig: clientCfg})
+		if err != nil {
+			// TLS 1.3中客户端证书在握手之后才被校验，错误可能在第一次调用时才出现
+			return
+		}
+		defer func() { _ = c.Close() }()
+		if _, err := me(c); err == nil {
+			t.Fatal("expect the connection without client cert to be rejected")
+		}
+	})
+	t.Run("with authenticator", func(t *testing.T) {
+		addr := startTLSServer(t, serverCfg, &diyrpc.TokenAuthenticator{Tokens: map[string]string{"t0ken": "dave"}})
+		clientCfg, _ := ca.ClientConfig("carol")
+		c, err := Dial("tcp", addr, &diyrpc.Option{TLSConfig: clientCfg, Credentials: diyrpc.BearerCredentials("t0ken")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer func() { _ = c.Close() }()
+		if got, err := me(c); err != nil || got != "bearer:dave" {
+			t.Fatalf("identity %q, %v", got, err)
+		}
+		// 认证器给出身份时仍然可以拿到客户端证书
+		var cn string
+		if err := c.Call(context.Background(), "Whoami.Cert", struct{}{}, &cn); err != nil || cn != "carol" {
+			t.Fatalf("certificate %q, %v", cn, err)
+		}
+	})
+}
@@ -0,0 +1,21 @@
+// 使用rpcgen生成客户端的例子
+package example
+
+import (
+	"context"
+	"tinyRPCFramwork/service"
+)
+
+//go:generate go run tinyRPCFramwork/cmd/rpcgen -type Arith
+
+type Args struct {
+	A, B int
+}
+
+type Arith interface {
+	Sum(ctx context.Context, args Args, reply *int) error
+	Concat(args []string, reply *string) error
+	Range(args int, stream service.Stream[int]) error
+	Total(stream service.ClientStream[int], reply *int) error
+	Echo(ctx context.Context, stream service.BidiStream[string, string]) error
+}
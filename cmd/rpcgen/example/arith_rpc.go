@@ -0,0 +1,73 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package example
+
+import (
+	"context"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/service"
+)
+
+// ArithClient 通过client.Client调用Arith服务
+type ArithClient struct {
+	c *client.Client
+}
+
+func NewArithClient(c *client.Client) *ArithClient {
+	return &ArithClient{c: c}
+}
+
+func (x *ArithClient) Sum(ctx context.Context, args Args) (int, error) {
+	var reply int
+	err := x.c.Call(ctx, "Arith.Sum", args, &reply)
+	return reply, err
+}
+
+func (x *ArithClient) Concat(ctx context.Context, args []string) (string, error) {
+	var reply string
+	err := x.c.Call(ctx, "Arith.Concat", args, &reply)
+	return reply, err
+}
+
+func (x *ArithClient) Range(ctx context.Context, args int) (*client.StreamReader[int], error) {
+	return client.ServerStream[int](ctx, x.c, "Arith.Range", args)
+}
+
+func (x *ArithClient) Total(ctx context.Context) (*client.StreamWriter[int, int], error) {
+	return client.ClientStream[int, int](ctx, x.c, "Arith.Total")
+}
+
+func (x *ArithClient) Echo(ctx context.Context) (*client.StreamConn[string, string], error) {
+	return client.BidiStream[string, string](ctx, x.c, "Arith.Echo")
+}
+
+// 服务端只暴露Arith中的方法
+type arithServer struct {
+	impl Arith
+}
+
+func (s *arithServer) Sum(ctx context.Context, args Args, reply *int) error {
+	return s.impl.Sum(ctx, args, reply)
+}
+
+func (s *arithServer) Concat(args []string, reply *string) error {
+	return s.impl.Concat(args, reply)
+}
+
+func (s *arithServer) Range(args int, stream service.Stream[int]) error {
+	return s.impl.Range(args, stream)
+}
+
+func (s *arithServer) Total(stream service.ClientStream[int], reply *int) error {
+	return s.impl.Total(stream, reply)
+}
+
+func (s *arithServer) Echo(ctx context.Context, stream service.BidiStream[string, string]) error {
+	return s.impl.Echo(ctx, stream)
+}
+
+// 以Arith为服务名注册impl
+func RegisterArith(s *diyrpc.Server, impl Arith) error {
+	return s.RegisterName("Arith", &arithServer{impl: impl})
+}
@@ -0,0 +1,117 @@
+package example
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/service"
+)
+
+type arith struct{}
+
+func (arith) Sum(ctx context.Context, args Args, reply *int) error {
+	*reply = args.A + args.B
+	return nil
+}
+
+func (arith) Concat(args []string, reply *string) error {
+	*reply = strings.Join(args, "")
+	return nil
+}
+
+func (arith) Range(args int, stream service.Stream[int]) error {
+	for i := 0; i < args; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (arith) Total(stream service.ClientStream[int], reply *int) error {
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*reply += n
+	}
+}
+
+func (arith) Echo(ctx context.Context, stream service.BidiStream[string, string]) error {
+	for {
+		s, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(s); err != nil {
+			return err
+		}
+	}
+}
+
+func TestArithClient(t *testing.T) {
+	code.Init()
+	s := diyrpc.NewServer()
+	if err := RegisterArith(s, arith{}); err != nil {
+		t.Fatal(err)
+	}
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	x := NewArithClient(c)
+	ctx := context.Background()
+
+	if sum, err := x.Sum(ctx, Args{A: 1, B: 2}); err != nil || sum != 3 {
+		t.Fatalf("expect 3, got %d %v", sum, err)
+	}
+	if s, err := x.Concat(ctx, []string{"a", "b"}); err != nil || s != "ab" {
+		t.Fatalf("expect ab, got %q %v", s, err)
+	}
+	r, err := x.Range(ctx, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range r.Chan() {
+		n++
+	}
+	if n != 3 || r.Err() != nil {
+		t.Fatalf("expect 3 messages, got %d %v", n, r.Err())
+	}
+	w, err := x.Total(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 3; i++ {
+		_ = w.Send(i)
+	}
+	if total, err := w.CloseAndRecv(); err != nil || total != 6 {
+		t.Fatalf("expect 6, got %d %v", total, err)
+	}
+	e, err := x.Echo(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = e.Send("hi")
+	if s, err := e.Recv(); err != nil || s != "hi" {
+		t.Fatalf("expect hi, got %q %v", s, err)
+	}
+	_ = e.CloseSend()
+}
@@ -0,0 +1,87 @@
+// Code generated by rpcgen. DO NOT EDIT.
+
+package calc
+
+import (
+	"context"
+	"time"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/service"
+)
+
+// Operands是Add的参数
+type Operands struct {
+	// 加数
+	Nums []int `json:"nums"`
+	At   time.Time
+}
+
+// Result是Add的结果
+type Result struct {
+	Sum    int
+	Labels map[string]string
+}
+
+// Calc提供简单的计算
+type Calc interface {
+	// 求和
+	Add(ctx context.Context, args Operands, reply *Result) error
+	// 依次返回0到n-1
+	Range(ctx context.Context, args int, stream service.Stream[int]) error
+	Total(ctx context.Context, stream service.ClientStream[int], reply *int) error
+	Echo(ctx context.Context, stream service.BidiStream[string, string]) error
+}
+
+// CalcClient 通过client.Client调用Calc服务
+type CalcClient struct {
+	c *client.Client
+}
+
+func NewCalcClient(c *client.Client) *CalcClient {
+	return &CalcClient{c: c}
+}
+
+func (x *CalcClient) Add(ctx context.Context, args Operands) (Result, error) {
+	var reply Result
+	err := x.c.Call(ctx, "Calc.Add", args, &reply)
+	return reply, err
+}
+
+func (x *CalcClient) Range(ctx context.Context, args int) (*client.StreamReader[int], error) {
+	return client.ServerStream[int](ctx, x.c, "Calc.Range", args)
+}
+
+func (x *CalcClient) Total(ctx context.Context) (*client.StreamWriter[int, int], error) {
+	return client.ClientStream[int, int](ctx, x.c, "Calc.Total")
+}
+
+func (x *CalcClient) Echo(ctx context.Context) (*client.StreamConn[string, string], error) {
+	return client.BidiStream[string, string](ctx, x.c, "Calc.Echo")
+}
+
+// 服务端只暴露Calc中的方法
+type calcServer struct {
+	impl Calc
+}
+
+func (s *calcServer) Add(ctx context.Context, args Operands, reply *Result) error {
+	return s.impl.Add(ctx, args, reply)
+}
+
+func (s *calcServer) Range(ctx context.Context, args int, stream service.Stream[int]) error {
+	return s.impl.Range(ctx, args, stream)
+}
+
+func (s *calcServer) Total(ctx context.Context, stream service.ClientStream[int], reply *int) error {
+	return s.impl.Total(ctx, stream, reply)
+}
+
+func (s *calcServer) Echo(ctx context.Context, stream service.BidiStream[string, string]) error {
+	return s.impl.Echo(ctx, stream)
+}
+
+// 以Calc为服务名注册impl
+func RegisterCalc(s *diyrpc.Server, impl Calc) error {
+	return s.RegisterName("Calc", &calcServer{impl: impl})
+}
@@ -0,0 +1,108 @@
+package calc
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/service"
+)
+
+type calc struct{}
+
+func (calc) Add(ctx context.Context, args Operands, reply *Result) error {
+	for _, n := range args.Nums {
+		reply.Sum += n
+	}
+	reply.Labels = map[string]string{"at": args.At.Format(time.RFC3339)}
+	return nil
+}
+
+func (calc) Range(ctx context.Context, args int, stream service.Stream[int]) error {
+	for i := 0; i < args; i++ {
+		if err := stream.Send(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (calc) Total(ctx context.Context, stream service.ClientStream[int], reply *int) error {
+	for {
+		n, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		*reply += n
+	}
+}
+
+func (calc) Echo(ctx context.Context, stream service.BidiStream[string, string]) error {
+	for {
+		s, err := stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := stream.Send(s); err != nil {
+			return err
+		}
+	}
+}
+
+func TestCalcClient(t *testing.T) {
+	code.Init()
+	s := diyrpc.NewServer()
+	if err := RegisterCalc(s, calc{}); err != nil {
+		t.Fatal(err)
+	}
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer func() { _ = l.Close() }()
+	go s.Accept(l)
+	c, err := client.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+	x := NewCalcClient(c)
+	ctx := context.Background()
+
+	at := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	res, err := x.Add(ctx, Operands{Nums: []int{1, 2, 3}, At: at})
+	if err != nil || res.Sum != 6 || res.Labels["at"] != "2024-01-02T03:04:05Z" {
+		t.Fatalf("unexpected result %+v %v", res, err)
+	}
+	r, err := x.Range(ctx, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	for range r.Chan() {
+		n++
+	}
+	if n != 4 || r.Err() != nil {
+		t.Fatalf("expect 4 messages, got %d %v", n, r.Err())
+	}
+	w, _ := x.Total(ctx)
+	for i := 1; i <= 4; i++ {
+		_ = w.Send(i)
+	}
+	if total, err := w.CloseAndRecv(); err != nil || total != 10 {
+		t.Fatalf("expect 10, got %d %v", total, err)
+	}
+	e, _ := x.Echo(ctx)
+	_ = e.Send("hi")
+	if s, err := e.Recv(); err != nil || s != "hi" {
+		t.Fatalf("expect hi, got %q %v", s, err)
+	}
+	_ = e.CloseSend()
+}
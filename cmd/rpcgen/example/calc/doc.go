@@ -0,0 +1,4 @@
+// calc的代码由calc.rpc生成
+package calc
+
+//go:generate go run tinyRPCFramwork/cmd/rpcgen calc.rpc
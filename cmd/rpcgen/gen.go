@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const servicePath = "tinyRPCFramwork/service"
+
+// 方法的调用方式，和service.StreamKind对应
+type methodKind int
+
+const (
+	unary methodKind = iota
+	serverStreaming
+	clientStreaming
+	bidiStreaming
+)
+
+type method struct {
+	Name    string
+	Kind    methodKind
+	HasCtx  bool
+	Args    string
+	Reply   string
+	Params  string
+	Forward string
+}
+
+type stubs struct {
+	Service string
+	Methods []*method
+}
+
+type file struct {
+	Package string
+	Imports []string
+	// IDL中的消息和接口定义
+	Decls    string
+	Services []*stubs
+}
+
+// 从src中读取名为typeName的接口，生成客户端和注册函数
+func generate(filename string, src []byte, typeName string) ([]byte, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		return nil, err
+	}
+	out := &file{Package: f.Name.Name}
+	used := map[string]bool{"context": true, "tinyRPCFramwork/client": true, "tinyRPCFramwork/diyrpc": true}
+	if err := out.addService(fset, f, typeName, used); err != nil {
+		return nil, err
+	}
+	return out.render(f, used)
+}
+
+// 为f中名为typeName的接口生成客户端，签名中用到的导入路径记录在used中
+func (out *file) addService(fset *token.FileSet, f *ast.File, typeName string, used map[string]bool) error {
+	iface := findInterface(f, typeName)
+	if iface == nil {
+		return fmt.Errorf("interface %s not found in %s", typeName, fset.Position(f.Pos()).Filename)
+	}
+	imports := importNames(f)
+	serviceName := "service"
+	for name, p := range imports {
+		if p == servicePath {
+			serviceName = name
+		}
+	}
+	svc := &stubs{Service: typeName}
+	for _, field := range iface.Methods.List {
+		ft, ok := field.Type.(*ast.FuncType)
+		if !ok || len(field.Names) == 0 {
+			return fmt.Errorf("%s: embedded interfaces are not supported", fset.Position(field.Pos()))
+		}
+		m, err := parseMethod(field.Names[0].Name, ft, serviceName)
+		if err != nil {
+			return fmt.Errorf("%s: %v", fset.Position(field.Pos()), err)
+		}
+		svc.Methods = append(svc.Methods, m)
+		// 签名中用到的包都要导入
+		ast.Inspect(ft, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if x, ok := sel.X.(*ast.Ident); ok && imports[x.Name] != "" {
+					used[imports[x.Name]] = true
+				}
+			}
+			return true
+		})
+	}
+	out.Services = append(out.Services, svc)
+	return nil
+}
+
+// f提供导入的别名
+func (out *file) render(f *ast.File, used map[string]bool) ([]byte, error) {
+	imports := importNames(f)
+	for p := range used {
+		name := ""
+		for n, ip := range imports {
+			if ip == p && n != path.Base(p) {
+				name = n + " "
+			}
+		}
+		out.Imports = append(out.Imports, name+strconv.Quote(p))
+	}
+	sort.Strings(out.Imports)
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, out); err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
+
+func findInterface(f *ast.File, name string) *ast.InterfaceType {
+	for _, decl := range f.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts := spec.(*ast.TypeSpec)
+			if iface, ok := ts.Type.(*ast.InterfaceType); ok && ts.Name.Name == name {
+				return iface
+			}
+		}
+	}
+	return nil
+}
+
+// 导入名到导入路径
+func importNames(f *ast.File) map[string]string {
+	names := make(map[string]string)
+	for _, spec := range f.Imports {
+		p, _ := strconv.Unquote(spec.Path.Value)
+		name := path.Base(p)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		names[name] = p
+	}
+	return names
+}
+
+// 方法的签名和服务端注册的要求相同，见service.registerMethods
+func parseMethod(name string, ft *ast.FuncType, serviceName string) (*method, error) {
+	var params []ast.Expr
+	for _, p := range ft.Params.List {
+		n := len(p.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, p.Type)
+		}
+	}
+	if ft.Results == nil || len(ft.Results.List) != 1 || types.ExprString(ft.Results.List[0].Type) != "error" {
+		return nil, fmt.Errorf("method %s must return only error", name)
+	}
+	m := &method{Name: name}
+	if len(params) > 0 && types.ExprString(params[0]) == "context.Context" {
+		m.HasCtx = true
+		params = params[1:]
+	}
+	var names []string
+	switch {
+	case len(params) == 1:
+		kind, typeArgs := streamParam(params[0], serviceName)
+		if kind != bidiStreaming {
+			return nil, fmt.Errorf("method %s: a single parameter must be %s.BidiStream", name, serviceName)
+		}
+		m.Kind, m.Args, m.Reply = kind, typeArgs[0], typeArgs[1]
+		names = []string{"stream"}
+	case len(params) == 2:
+		argKind, argTypes := streamParam(params[0], serviceName)
+		replyKind, replyTypes := streamParam(params[1], serviceName)
+		switch {
+		case argKind == unary && replyKind == serverStreaming:
+			m.Kind, m.Args, m.Reply = serverStreaming, types.ExprString(params[0]), replyTypes[0]
+			names = []string{"args", "stream"}
+		case argKind == clientStreaming && replyKind == unary:
+			reply, ok := params[1].(*ast.StarExpr)
+			if !ok {
+				return nil, fmt.Errorf("method %s: reply must be a pointer", name)
+			}
+			m.Kind, m.Args, m.Reply = clientStreaming, argTypes[0], types.ExprString(reply.X)
+			names = []string{"stream", "reply"}
+		case argKind == unary && replyKind == unary:
+			reply, ok := params[1].(*ast.StarExpr)
+			if !ok {
+				return nil, fmt.Errorf("method %s: reply must be a pointer", name)
+			}
+			m.Args, m.Reply = types.ExprString(params[0]), types.ExprString(reply.X)
+			names = []string{"args", "reply"}
+		default:
+			return nil, fmt.Errorf("method %s: unsupported stream parameters", name)
+		}
+	default:
+		return nil, fmt.Errorf("method %s must take args and reply", name)
+	}
+	var decl []string
+	if m.HasCtx {
+		names = append([]string{"ctx"}, names...)
+		params = append([]ast.Expr{nil}, params...)
+	}
+	for i, n := range names {
+		typ := "context.Context"
+		if params[i] != nil {
+			typ = types.ExprString(params[i])
+		}
+		decl = append(decl, n+" "+typ)
+	}
+	m.Params = strings.Join(decl, ", ")
+	m.Forward = strings.Join(names, ", ")
+	return m, nil
+}
+
+// 判断参数是否是service包中的流类型，返回流的类型参数
+func streamParam(expr ast.Expr, serviceName string) (methodKind, []string) {
+	var x ast.Expr
+	var indices []ast.Expr
+	switch e := expr.(type) {
+	case *ast.IndexExpr:
+		x, indices = e.X, []ast.Expr{e.Index}
+	case *ast.IndexListExpr:
+		x, indices = e.X, e.Indices
+	default:
+		return unary, nil
+	}
+	sel, ok := x.(*ast.SelectorExpr)
+	if !ok {
+		return unary, nil
+	}
+	if pkg, ok := sel.X.(*ast.Ident); !ok || pkg.Name != serviceName {
+		return unary, nil
+	}
+	typeArgs := make([]string, len(indices))
+	for i, index := range indices {
+		typeArgs[i] = types.ExprString(index)
+	}
+	switch {
+	case sel.Sel.Name == "Stream" && len(typeArgs) == 1:
+		return serverStreaming, typeArgs
+	case sel.Sel.Name == "ClientStream" && len(typeArgs) == 1:
+		return clientStreaming, typeArgs
+	case sel.Sel.Name == "BidiStream" && len(typeArgs) == 2:
+		return bidiStreaming, typeArgs
+	}
+	return unary, nil
+}
+
+var fileTemplate = template.Must(template.New("file").Funcs(template.FuncMap{
+	"lower": func(s string) string { return strings.ToLower(s[:1]) + s[1:] },
+}).Parse(`// Code generated by rpcgen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{if .Decls}}
+{{.Decls}}
+{{- end}}
+{{- range .Services}}
+{{template "stubs" .}}
+{{- end}}
+{{define "stubs"}}
+{{- $svc := .Service -}}
+// {{$svc}}Client 通过client.Client调用{{$svc}}服务
+type {{$svc}}Client struct {
+	c *client.Client
+}
+
+func New{{$svc}}Client(c *client.Client) *{{$svc}}Client {
+	return &{{$svc}}Client{c: c}
+}
+{{range .Methods}}
+{{- if eq .Kind 0}}
+func (x *{{$svc}}Client) {{.Name}}(ctx context.Context, args {{.Args}}) ({{.Reply}}, error) {
+	var reply {{.Reply}}
+	err := x.c.Call(ctx, "{{$svc}}.{{.Name}}", args, &reply)
+	return reply, err
+}
+{{- else if eq .Kind 1}}
+func (x *{{$svc}}Client) {{.Name}}(ctx context.Context, args {{.Args}}) (*client.StreamReader[{{.Reply}}], error) {
+	return client.ServerStream[{{.Reply}}](ctx, x.c, "{{$svc}}.{{.Name}}", args)
+}
+{{- else if eq .Kind 2}}
+func (x *{{$svc}}Client) {{.Name}}(ctx context.Context) (*client.StreamWriter[{{.Args}}, {{.Reply}}], error) {
+	return client.ClientStream[{{.Args}}, {{.Reply}}](ctx, x.c, "{{$svc}}.{{.Name}}")
+}
+{{- else}}
+func (x *{{$svc}}Client) {{.Name}}(ctx context.Context) (*client.StreamConn[{{.Args}}, {{.Reply}}], error) {
+	return client.BidiStream[{{.Args}}, {{.Reply}}](ctx, x.c, "{{$svc}}.{{.Name}}")
+}
+{{- end}}
+{{end}}
+// 服务端只暴露{{$svc}}中的方法
+type {{lower $svc}}Server struct {
+	impl {{$svc}}
+}
+{{range .Methods}}
+func (s *{{lower $svc}}Server) {{.Name}}({{.Params}}) error {
+	return s.impl.{{.Name}}({{.Forward}})
+}
+{{end}}
+// 以{{$svc}}为服务名注册impl
+func Register{{$svc}}(s *diyrpc.Server, impl {{$svc}}) error {
+	return s.RegisterName("{{$svc}}", &{{lower $svc}}Server{impl: impl})
+}
+{{end}}`))
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// example中的代码必须和生成器的输出一致，修改生成器后需要重新go generate
+func TestGenerate_Example(t *testing.T) {
+	src, err := os.ReadFile("example/arith.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := generate("example/arith.go", src, "Arith")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("example/arith_rpc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(want) {
+		t.Fatalf("example/arith_rpc.go is stale, run go generate ./cmd/rpcgen/example")
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	cases := map[string]string{
+		"not found":     "type Other interface{}",
+		"no error":      "type Svc interface{ M(args int, reply *int) }",
+		"reply pointer": "type Svc interface{ M(args int, reply int) error }",
+		"params":        "type Svc interface{ M(args int) error }",
+		"embedded":      "type Svc interface{ Other }",
+	}
+	for name, decl := range cases {
+		t.Run(name, func(t *testing.T) {
+			src := "package p\n" + decl + "\n"
+			if _, err := generate("p.go", []byte(src), "Svc"); err == nil {
+				t.Fatalf("expect an error for %q", strings.TrimSpace(decl))
+			}
+		})
+	}
+}
+
+func TestGenerateIDL_Example(t *testing.T) {
+	src, err := os.ReadFile("example/calc/calc.rpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := generateIDL("example/calc/calc.rpc", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile("example/calc/calc_rpc.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != string(want) {
+		t.Fatalf("example/calc/calc_rpc.go is stale, run go generate ./cmd/rpcgen/example/calc")
+	}
+}
+
+func TestParseIDL(t *testing.T) {
+	src := `package p
+
+// 不是文档注释
+
+// M的文档
+message M {
+	// 字段的文档
+	A []map[string]*M "tag"; B int
+}
+
+service S {
+	rpc Get(M) returns (stream int);
+}
+`
+	f, err := parseIDL("p.rpc", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := f.Messages[0]
+	if len(m.Doc) != 1 || m.Doc[0] != "M的文档" {
+		t.Fatalf("unexpected message doc %q", m.Doc)
+	}
+	if len(m.Fields) != 2 || m.Fields[0].Type != "[]map[string]*M" || m.Fields[0].Tag != "tag" || m.Fields[0].Doc[0] != "字段的文档" {
+		t.Fatalf("unexpected fields %+v", m.Fields)
+	}
+	get := f.Services[0].Methods[0]
+	if get.Args != "M" || get.Reply != "int" || get.ArgStream || !get.ReplyStream {
+		t.Fatalf("unexpected method %+v", get)
+	}
+}
+
+func TestParseIDL_Errors(t *testing.T) {
+	cases := map[string]string{
+		"no package":       "message M {}",
+		"unexported":       "package p\nmessage m {}",
+		"unexported field": "package p\nmessage M { a int }",
+		"undefined type":   "package p\nmessage M { A Missing }",
+		"not imported":     "package p\nmessage M { A time.Time }",
+		"redeclared":       "package p\nmessage M {}\nservice M {}",
+		"missing returns":  "package p\nservice S { rpc Get(int) (int) }",
+		"unclosed":         "package p\nmessage M { A int",
+		"bad character":    "package p\nmessage M { A int = 1 }",
+	}
+	for name, src := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := parseIDL("p.rpc", src); err == nil {
+				t.Fatalf("expect an error for %q", src)
+			}
+		})
+	}
+}
@@ -0,0 +1,550 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// IDL文件描述消息和服务，例如
+//
+//	package calc
+//
+//	import "time"
+//
+//	// Args是Add的参数
+//	message Args {
+//		// 第一个加数
+//		A int `json:"a"`
+//		B int
+//		At time.Time
+//	}
+//
+//	service Calc {
+//		// 求和
+//		rpc Add(Args) returns (int)
+//		rpc Range(int) returns (stream int)
+//		rpc Sum(stream int) returns (int)
+//		rpc Echo(stream string) returns (stream string)
+//	}
+//
+// 消息生成Go结构体，服务生成接口、客户端和注册函数，
+// 接口中每个方法的第一个参数都是context.Context
+// 类型使用Go的写法，可以是内置类型、消息、切片、map、指针和导入包中的类型
+// 分号可以省略，紧挨在定义前面的//注释会成为生成代码的文档注释
+type idlFile struct {
+	Package string
+	Imports []string
+	// 类型中用到的包名
+	usedPkgs map[string]bool
+	Messages []*idlMessage
+	Services []*idlService
+}
+
+type idlMessage struct {
+	Doc    []string
+	Name   string
+	Fields []*idlField
+}
+
+type idlField struct {
+	Doc  []string
+	Name string
+	Type string
+	Tag  string
+}
+
+type idlService struct {
+	Doc     []string
+	Name    string
+	Methods []*idlMethod
+}
+
+type idlMethod struct {
+	Doc         []string
+	Name        string
+	Args, Reply string
+	// 参数和返回值是否是流
+	ArgStream, ReplyStream bool
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokRawString
+	tokPunct
+)
+
+type idlToken struct {
+	kind tokenKind
+	text string
+	line int
+	col  int
+	// 紧挨在这个token前面的注释
+	doc []string
+}
+
+type idlParser struct {
+	filename string
+	toks     []idlToken
+	pos      int
+}
+
+func lexIDL(filename, src string) ([]idlToken, error) {
+	var toks []idlToken
+	var doc []string
+	line, col := 1, 1
+	// 上一个注释所在的行，注释和定义之间有空行时不算文档注释
+	docLine := 0
+	i := 0
+	advance := func(n int) {
+		for _, r := range src[i : i+n] {
+			if r == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+		}
+		i += n
+	}
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			advance(1)
+		case strings.HasPrefix(src[i:], "//"):
+			end := strings.IndexByte(src[i:], '\n')
+			if end < 0 {
+				end = len(src) - i
+			}
+			if docLine != line-1 {
+				doc = nil
+			}
+			doc = append(doc, strings.TrimSpace(src[i+2:i+end]))
+			docLine = line
+			advance(end)
+		case c == '"' || c == '`':
+			end := strings.IndexByte(src[i+1:], c)
+			if end < 0 || (c == '"' && strings.ContainsRune(src[i+1:i+1+end], '\n')) {
+				return nil, fmt.Errorf("%s:%d:%d: unterminated string", filename, line, col)
+			}
+			kind := tokString
+			if c == '`' {
+				kind = tokRawString
+			}
+			toks = append(toks, idlToken{kind: kind, text: src[i : i+end+2], line: line, col: col})
+			advance(end + 2)
+		case c == '_' || unicode.IsLetter(rune(c)):
+			end := i
+			for end < len(src) && (src[end] == '_' || unicode.IsLetter(rune(src[end])) || unicode.IsDigit(rune(src[end]))) {
+				end++
+			}
+			tok := idlToken{kind: tokIdent, text: src[i:end], line: line, col: col}
+			if docLine == line-1 {
+				tok.doc = doc
+			}
+			toks = append(toks, tok)
+			doc, docLine = nil, 0
+			advance(end - i)
+		case strings.ContainsRune("{}()[];,.*", rune(c)):
+			toks = append(toks, idlToken{kind: tokPunct, text: string(c), line: line, col: col})
+			doc, docLine = nil, 0
+			advance(1)
+		default:
+			return nil, fmt.Errorf("%s:%d:%d: unexpected character %q", filename, line, col, c)
+		}
+	}
+	toks = append(toks, idlToken{kind: tokEOF, line: line, col: col})
+	return toks, nil
+}
+
+func parseIDL(filename, src string) (*idlFile, error) {
+	toks, err := lexIDL(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	p := &idlParser{filename: filename, toks: toks}
+	f := new(idlFile)
+	if err := p.expect("package"); err != nil {
+		return nil, err
+	}
+	if f.Package, err = p.ident(); err != nil {
+		return nil, err
+	}
+	p.semicolon()
+	for p.peek().text == "import" {
+		p.next()
+		tok := p.next()
+		if tok.kind != tokString {
+			return nil, p.errorf(tok, "expect import path")
+		}
+		path, _ := strconv.Unquote(tok.text)
+		f.Imports = append(f.Imports, path)
+		p.semicolon()
+	}
+	for p.peek().kind != tokEOF {
+		tok := p.peek()
+		switch tok.text {
+		case "message":
+			m, err := p.message()
+			if err != nil {
+				return nil, err
+			}
+			f.Messages = append(f.Messages, m)
+		case "service":
+			s, err := p.service()
+			if err != nil {
+				return nil, err
+			}
+			f.Services = append(f.Services, s)
+		default:
+			return nil, p.errorf(tok, "expect message or service, got %q", tok.text)
+		}
+	}
+	return f, p.check(f)
+}
+
+func (p *idlParser) peek() idlToken {
+	return p.toks[p.pos]
+}
+
+func (p *idlParser) next() idlToken {
+	tok := p.toks[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *idlParser) errorf(tok idlToken, format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d:%d: %s", p.filename, tok.line, tok.col, fmt.Sprintf(format, args...))
+}
+
+func (p *idlParser) expect(text string) error {
+	if tok := p.next(); tok.text != text {
+		return p.errorf(tok, "expect %q, got %q", text, tok.text)
+	}
+	return nil
+}
+
+func (p *idlParser) ident() (string, error) {
+	tok := p.next()
+	if tok.kind != tokIdent {
+		return "", p.errorf(tok, "expect identifier, got %q", tok.text)
+	}
+	return tok.text, nil
+}
+
+func (p *idlParser) semicolon() {
+	if p.peek().text == ";" {
+		p.next()
+	}
+}
+
+// 类型按Go的写法解析，返回规范化后的文本
+func (p *idlParser) typ() (string, error) {
+	tok := p.next()
+	switch {
+	case tok.text == "*":
+		elem, err := p.typ()
+		return "*" + elem, err
+	case tok.text == "[":
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		elem, err := p.typ()
+		return "[]" + elem, err
+	case tok.text == "map":
+		if err := p.expect("["); err != nil {
+			return "", err
+		}
+		key, err := p.typ()
+		if err != nil {
+			return "", err
+		}
+		if err := p.expect("]"); err != nil {
+			return "", err
+		}
+		elem, err := p.typ()
+		return "map[" + key + "]" + elem, err
+	case tok.kind == tokIdent:
+		if p.peek().text != "." {
+			return tok.text, nil
+		}
+		p.next()
+		sel, err := p.ident()
+		return tok.text + "." + sel, err
+	}
+	return "", p.errorf(tok, "expect type, got %q", tok.text)
+}
+
+func (p *idlParser) message() (*idlMessage, error) {
+	m := &idlMessage{Doc: p.next().doc}
+	var err error
+	if m.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.peek().text != "}" {
+		tok := p.peek()
+		if tok.kind == tokEOF {
+			return nil, p.errorf(tok, "message %s not closed", m.Name)
+		}
+		field := &idlField{Doc: tok.doc}
+		if field.Name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if field.Type, err = p.typ(); err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next.kind == tokRawString || next.kind == tokString {
+			field.Tag, _ = strconv.Unquote(p.next().text)
+		}
+		p.semicolon()
+		m.Fields = append(m.Fields, field)
+	}
+	p.next()
+	p.semicolon()
+	return m, nil
+}
+
+func (p *idlParser) service() (*idlService, error) {
+	s := &idlService{Doc: p.next().doc}
+	var err error
+	if s.Name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	for p.peek().text != "}" {
+		tok := p.next()
+		if tok.text != "rpc" {
+			return nil, p.errorf(tok, "expect rpc, got %q", tok.text)
+		}
+		m := &idlMethod{Doc: tok.doc}
+		if m.Name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if m.ArgStream, m.Args, err = p.params(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("returns"); err != nil {
+			return nil, err
+		}
+		if m.ReplyStream, m.Reply, err = p.params(); err != nil {
+			return nil, err
+		}
+		p.semicolon()
+		s.Methods = append(s.Methods, m)
+	}
+	p.next()
+	p.semicolon()
+	return s, nil
+}
+
+// ( [stream] type )
+func (p *idlParser) params() (bool, string, error) {
+	if err := p.expect("("); err != nil {
+		return false, "", err
+	}
+	stream := false
+	if p.peek().text == "stream" {
+		p.next()
+		stream = true
+	}
+	typ, err := p.typ()
+	if err != nil {
+		return false, "", err
+	}
+	return stream, typ, p.expect(")")
+}
+
+var builtinTypes = map[string]bool{
+	"bool": true, "string": true, "byte": true, "rune": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true, "complex64": true, "complex128": true,
+}
+
+// 检查名字是否公开、是否重复，类型是否定义过
+func (p *idlParser) check(f *idlFile) error {
+	names := make(map[string]bool)
+	declare := func(name string) error {
+		if !ast.IsExported(name) {
+			return fmt.Errorf("%s: %s must be exported", p.filename, name)
+		}
+		if names[name] {
+			return fmt.Errorf("%s: %s redeclared", p.filename, name)
+		}
+		names[name] = true
+		return nil
+	}
+	for _, m := range f.Messages {
+		if err := declare(m.Name); err != nil {
+			return err
+		}
+	}
+	imported := make(map[string]bool)
+	f.usedPkgs = make(map[string]bool)
+	for _, path := range f.Imports {
+		imported[path[strings.LastIndex(path, "/")+1:]] = true
+	}
+	checkType := func(typ string) error {
+		expr, err := parser.ParseExpr(typ)
+		if err != nil {
+			return err
+		}
+		var bad error
+		ast.Inspect(expr, func(n ast.Node) bool {
+			switch e := n.(type) {
+			case *ast.SelectorExpr:
+				if x, ok := e.X.(*ast.Ident); ok {
+					if !imported[x.Name] {
+						bad = fmt.Errorf("%s: package %s not imported", p.filename, x.Name)
+					}
+					f.usedPkgs[x.Name] = true
+				}
+				return false
+			case *ast.Ident:
+				if !builtinTypes[e.Name] && !names[e.Name] {
+					bad = fmt.Errorf("%s: undefined type %s", p.filename, e.Name)
+				}
+			}
+			return true
+		})
+		return bad
+	}
+	for _, m := range f.Messages {
+		fields := make(map[string]bool)
+		for _, field := range m.Fields {
+			if !ast.IsExported(field.Name) {
+				return fmt.Errorf("%s: field %s.%s must be exported", p.filename, m.Name, field.Name)
+			}
+			if fields[field.Name] {
+				return fmt.Errorf("%s: field %s.%s redeclared", p.filename, m.Name, field.Name)
+			}
+			fields[field.Name] = true
+			if err := checkType(field.Type); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range f.Services {
+		if err := declare(s.Name); err != nil {
+			return err
+		}
+		methods := make(map[string]bool)
+		for _, m := range s.Methods {
+			if !ast.IsExported(m.Name) {
+				return fmt.Errorf("%s: method %s.%s must be exported", p.filename, s.Name, m.Name)
+			}
+			if methods[m.Name] {
+				return fmt.Errorf("%s: method %s.%s redeclared", p.filename, s.Name, m.Name)
+			}
+			methods[m.Name] = true
+			if err := checkType(m.Args); err != nil {
+				return err
+			}
+			if err := checkType(m.Reply); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// 消息和服务接口的Go代码
+func (f *idlFile) decls() string {
+	var b strings.Builder
+	writeDoc := func(indent string, doc []string) {
+		for _, line := range doc {
+			b.WriteString(indent + "// " + line + "\n")
+		}
+	}
+	for _, m := range f.Messages {
+		writeDoc("", m.Doc)
+		fmt.Fprintf(&b, "type %s struct {\n", m.Name)
+		for _, field := range m.Fields {
+			writeDoc("\t", field.Doc)
+			fmt.Fprintf(&b, "\t%s %s", field.Name, field.Type)
+			if field.Tag != "" {
+				if strings.Contains(field.Tag, "`") {
+					b.WriteString(" " + strconv.Quote(field.Tag))
+				} else {
+					b.WriteString(" `" + field.Tag + "`")
+				}
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n\n")
+	}
+	for _, s := range f.Services {
+		writeDoc("", s.Doc)
+		fmt.Fprintf(&b, "type %s interface {\n", s.Name)
+		for _, m := range s.Methods {
+			writeDoc("\t", m.Doc)
+			fmt.Fprintf(&b, "\t%s(ctx context.Context, %s) error\n", m.Name, m.params())
+		}
+		b.WriteString("}\n\n")
+	}
+	return b.String()
+}
+
+// 服务端方法的参数，和service.registerMethods的要求一致
+func (m *idlMethod) params() string {
+	switch {
+	case m.ArgStream && m.ReplyStream:
+		return fmt.Sprintf("stream service.BidiStream[%s, %s]", m.Args, m.Reply)
+	case m.ArgStream:
+		return fmt.Sprintf("stream service.ClientStream[%s], reply *%s", m.Args, m.Reply)
+	case m.ReplyStream:
+		return fmt.Sprintf("args %s, stream service.Stream[%s]", m.Args, m.Reply)
+	}
+	return fmt.Sprintf("args %s, reply *%s", m.Args, m.Reply)
+}
+
+// 从IDL生成消息、服务接口、客户端和注册函数
+func generateIDL(filename string, src []byte) ([]byte, error) {
+	idl, err := parseIDL(filename, string(src))
+	if err != nil {
+		return nil, err
+	}
+	decls := idl.decls()
+	// 生成的接口按Go代码解析，再复用从接口生成客户端的逻辑
+	var header strings.Builder
+	fmt.Fprintf(&header, "package %s\n\nimport (\n\t%q\n\t%q\n", idl.Package, "context", servicePath)
+	for _, path := range idl.Imports {
+		fmt.Fprintf(&header, "\t%q\n", path)
+	}
+	header.WriteString(")\n\n")
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, filename+".go", header.String()+decls, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	out := &file{Package: idl.Package, Decls: strings.TrimSpace(decls)}
+	used := map[string]bool{"context": true, "tinyRPCFramwork/client": true, "tinyRPCFramwork/diyrpc": true}
+	// 没有用到的导入不写入生成的代码，否则无法编译
+	for _, path := range idl.Imports {
+		if idl.usedPkgs[path[strings.LastIndex(path, "/")+1:]] {
+			used[path] = true
+		}
+	}
+	for _, s := range idl.Services {
+		if err := out.addService(fset, f, s.Name, used); err != nil {
+			return nil, err
+		}
+	}
+	return out.render(f, used)
+}
@@ -0,0 +1,73 @@
+// rpcgen根据Go接口生成带类型的客户端和服务端注册函数
+//
+// 用法：
+//
+//	//go:generate go run tinyRPCFramwork/cmd/rpcgen -type Arith
+//
+// 接口中每个方法的签名和服务端方法相同，例如
+//
+//	type Arith interface {
+//		Sum(ctx context.Context, args Args, reply *int) error
+//		Count(args int, stream service.Stream[int]) error
+//	}
+//
+// 生成ArithClient、NewArithClient和RegisterArith，
+// 方法改名后调用方会编译失败，而不是在运行时找不到方法
+//
+// 源文件是.rpc时按IDL解析，不需要-type，IDL的语法见idl.go：
+//
+//	//go:generate go run tinyRPCFramwork/cmd/rpcgen calc.rpc
+//
+// 生成消息结构体、服务接口以及每个服务的客户端和注册函数，默认输出到calc_rpc.go
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+func main() {
+	typeName := flag.String("type", "", "interface name")
+	output := flag.String("output", "", "output file, default <type>_rpc.go next to the source")
+	flag.Parse()
+	filename := flag.Arg(0)
+	if filename == "" {
+		// go generate会设置GOFILE
+		filename = os.Getenv("GOFILE")
+	}
+	isIDL := strings.HasSuffix(filename, ".rpc")
+	if (*typeName == "" && !isIDL) || filename == "" {
+		fmt.Fprintln(os.Stderr, "usage: rpcgen -type Name [-output file] [source.go]")
+		fmt.Fprintln(os.Stderr, "       rpcgen [-output file] source.rpc")
+		os.Exit(2)
+	}
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rpcgen:", err)
+		os.Exit(1)
+	}
+	var out []byte
+	if isIDL {
+		out, err = generateIDL(filename, src)
+	} else {
+		out, err = generate(filename, src, *typeName)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "rpcgen:", err)
+		os.Exit(1)
+	}
+	if *output == "" {
+		if isIDL {
+			*output = strings.TrimSuffix(filename, ".rpc") + "_rpc.go"
+		} else {
+			*output = filepath.Join(filepath.Dir(filename), strings.ToLower(*typeName)+"_rpc.go")
+		}
+	}
+	if err := os.WriteFile(*output, out, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "rpcgen:", err)
+		os.Exit(1)
+	}
+}
@@ -2,8 +2,8 @@ package code
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/gob"
-	"fmt"
 	"io"
 	"tinyRPCFramwork/irpc"
 )
@@ -15,47 +15,121 @@ type GobCode struct {
 	// 高效地读写数据流
 	// 通过使用bufio包，可以避免频繁系统调用，从而提高生活性能
 	buf *bufio.Writer
-	dec *gob.Decoder
-	enc *gob.Encoder
+	// 合并写时代替buf，为空时每次Write都flush
+	fw *flushWriter
+	// 在gob之前检查消息大小
+	lr     *limitReader
+	limits Limits
+	dec    *gob.Decoder
+	enc    *gob.Encoder
+	// 为空时使用irpc.DefaultLogger
+	logger irpc.Logger
 }
 
 var _ irpc.ICode = (*GobCode)(nil)
+var _ Limited = (*GobCode)(nil)
+var _ Logged = (*GobCode)(nil)
 
+// 可以设置Logger的编码器，服务端和客户端创建编码器后传入带连接地址的Logger
+type Logged interface {
+	SetLogger(l irpc.Logger)
+}
+
+// 使用DefaultWriteOption合并写
 func NewGobCode(conn io.ReadWriteCloser) irpc.ICode {
-	buf := bufio.NewWriter(conn)
-	return &GobCode{
+	return NewGobCodeOption(conn, DefaultWriteOption)
+}
+
+// opt为空时每次Write都flush
+func NewGobCodeOption(conn io.ReadWriteCloser, opt *WriteOption) irpc.ICode {
+	gc := &GobCode{
 		conn: conn,
-		buf:  buf,
-		dec:  gob.NewDecoder(conn),
-		enc:  gob.NewEncoder(buf),
+		lr:   newLimitReader(conn),
+	}
+	gc.dec = gob.NewDecoder(gc.lr)
+	if opt == nil {
+		gc.buf = bufio.NewWriter(conn)
+		gc.enc = gob.NewEncoder(gc.buf)
+	} else {
+		gc.fw = newFlushWriter(conn, opt)
+		gc.enc = gob.NewEncoder(gc.fw)
 	}
+	return gc
 }
+func (gc *GobCode) SetLimits(l *Limits) {
+	gc.limits = Limits{}
+	if l != nil {
+		gc.limits = *l
+	}
+}
+
+func (gc *GobCode) SetLogger(l irpc.Logger) {
+	gc.logger = l
+}
+
 func (gc *GobCode) ReadHeader(header *irpc.Header) error {
+	gc.lr.set("header", gc.limits.MaxHeaderSize, gc.limits.CloseOnOversize)
 	return gc.dec.Decode(header)
 }
 func (gc *GobCode) ReadBody(body interface{}) error {
+	gc.lr.set("body", gc.limits.MaxBodySize, gc.limits.CloseOnOversize)
 	return gc.dec.Decode(body)
 }
+
+// 合并写时消息写入缓冲区就返回，由后台的goroutine写入连接，
+// 连接的写错误会在之后的Write中返回
 func (gc *GobCode) Write(header *irpc.Header, body interface{}) (err error) {
+	if gc.fw != nil {
+		if err := gc.fw.error(); err != nil {
+			return err
+		}
+	}
 	defer func() {
-		_ = gc.buf.Flush()
+		if gc.fw != nil {
+			gc.fw.kick()
+			// 缓冲区满时kick同步写出，写失败时这条消息没有完整写出
+			if err == nil {
+				err = gc.fw.error()
+			}
+		} else {
+			_ = gc.buf.Flush()
+		}
 		if err != nil {
 			gc.Close()
 		}
 	}()
 	err = gc.enc.Encode(header)
 	if err != nil {
-		fmt.Println("Header Writer encode err: ", err)
+		irpc.LoggerOr(gc.logger).Error("encode header failed", "method", header.ServiceMethod, "seq", header.Seq, "err", err)
 		return err
 	}
 	err = gc.enc.Encode(body)
 	if err != nil {
-		fmt.Println("Body Writer encode err: ", err)
+		irpc.LoggerOr(gc.logger).Error("encode body failed", "method", header.ServiceMethod, "seq", header.Seq, "err", err)
 		return err
 	}
 	return nil
 }
+
+// 每个值都要带上自己的类型信息才能单独解码，批量调用中的值又是并发、乱序解码的，
+// 所以不能复用连接上的gob编码器，每次新建
+func (gc *GobCode) EncodeValue(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (gc *GobCode) DecodeValue(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// 合并写时先写出缓冲区中的消息再关闭连接
 func (gc *GobCode) Close() error {
+	if gc.fw != nil {
+		gc.fw.close()
+	}
 	return gc.conn.Close()
 }
 func Init() {
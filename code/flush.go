@@ -0,0 +1,153 @@
+package code
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"time"
+)
+
+type WriteOption struct {
+	// 收到第一条消息后最多等待这么久再flush，让这段时间内的消息一起写出，
+	// 0表示不等待，只合并flush期间积压的消息
+	FlushDelay time.Duration
+	// 缓冲区超过这个大小时由Write同步写出，避免写得比连接快时无限堆积
+	MaxBuffered int
+}
+
+var DefaultWriteOption = &WriteOption{
+	MaxBuffered: 64 << 10,
+}
+
+// 关闭时写出剩下数据的最长时间，对方不读时不能让Close一直阻塞
+const closeFlushTimeout = time.Second
+
+// net.Conn实现了这个接口
+type writeDeadliner interface {
+	SetWriteDeadline(t time.Time) error
+}
+
+// 合并写的缓冲区
+// Write只把数据追加到buf，flush时和spare交换，在锁外写入连接，
+// 写连接期间新来的消息会在下一次flush中一起写出
+type flushWriter struct {
+	conn io.WriteCloser
+	opt  *WriteOption
+
+	mu    sync.Mutex
+	buf   *bytes.Buffer
+	spare *bytes.Buffer
+	err   error
+
+	// 保证同一时间只有一个flush写连接
+	writing sync.Mutex
+	// 有数据待写出，容量为1
+	pending chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+func newFlushWriter(conn io.WriteCloser, opt *WriteOption) *flushWriter {
+	fw := &flushWriter{
+		conn:    conn,
+		opt:     opt,
+		buf:     new(bytes.Buffer),
+		spare:   new(bytes.Buffer),
+		pending: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go fw.loop()
+	return fw
+}
+
+func (fw *flushWriter) Write(p []byte) (int, error) {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	if fw.err != nil {
+		return 0, fw.err
+	}
+	return fw.buf.Write(p)
+}
+
+func (fw *flushWriter) error() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+	return fw.err
+}
+
+// 一条消息写完，通知后台goroutine写出
+func (fw *flushWriter) kick() {
+	fw.mu.Lock()
+	full := fw.opt.MaxBuffered > 0 && fw.buf.Len() >= fw.opt.MaxBuffered
+	fw.mu.Unlock()
+	if full {
+		fw.flush()
+		return
+	}
+	select {
+	case fw.pending <- struct{}{}:
+	default:
+	}
+}
+
+func (fw *flushWriter) loop() {
+	defer close(fw.stopped)
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-fw.pending:
+		}
+		if fw.opt.FlushDelay > 0 {
+			select {
+			case <-fw.done:
+				return
+			case <-time.After(fw.opt.FlushDelay):
+			}
+		}
+		fw.flush()
+	}
+}
+
+func (fw *flushWriter) flush() {
+	fw.writing.Lock()
+	defer fw.writing.Unlock()
+	fw.mu.Lock()
+	if fw.buf.Len() == 0 || fw.err != nil {
+		fw.mu.Unlock()
+		return
+	}
+	fw.buf, fw.spare = fw.spare, fw.buf
+	fw.mu.Unlock()
+	_, err := fw.conn.Write(fw.spare.Bytes())
+	fw.spare.Reset()
+	if err != nil {
+		fw.mu.Lock()
+		fw.err = err
+		fw.mu.Unlock()
+		_ = fw.conn.Close()
+	}
+}
+
+// 停止后台goroutine并写出剩下的数据
+// 后台goroutine可能正阻塞在写连接中，先设置写超时再等待它退出，
+// 连接不支持超时时直接关闭连接，放弃剩下的数据
+func (fw *flushWriter) close() {
+	fw.once.Do(func() {
+		close(fw.done)
+		if d, ok := fw.conn.(writeDeadliner); ok {
+			_ = d.SetWriteDeadline(time.Now().Add(closeFlushTimeout))
+		} else {
+			_ = fw.conn.Close()
+		}
+		<-fw.stopped
+		fw.flush()
+		fw.mu.Lock()
+		if fw.err == nil {
+			fw.err = io.ErrClosedPipe
+		}
+		fw.mu.Unlock()
+	})
+}
@@ -0,0 +1,40 @@
+package code
+
+import (
+	"net"
+	"testing"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+func TestGobCodeClose_PeerNotReading(t *testing.T) {
+	local, remote := net.Pipe()
+	defer func() { _ = remote.Close() }()
+	cc := NewGobCode(local)
+	// 消息写入缓冲区后由后台goroutine写连接，对方不读时一直阻塞
+	if err := cc.Write(&irpc.Header{ServiceMethod: "Echo.Echo", Seq: 1}, 1); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	closed := make(chan struct{})
+	go func() {
+		_ = cc.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Close blocked by a peer that is not reading")
+	}
+}
+
+func TestGobCodeWrite_FlushError(t *testing.T) {
+	local, remote := net.Pipe()
+	_ = remote.Close()
+	cc := NewGobCode(local)
+	// 超过MaxBuffered时同步写出，写失败要返回给调用方
+	big := make([]byte, DefaultWriteOption.MaxBuffered)
+	if err := cc.Write(&irpc.Header{ServiceMethod: "Blob.Len", Seq: 1}, big); err == nil {
+		t.Fatal("expect the write error of the synchronous flush")
+	}
+}
@@ -0,0 +1,145 @@
+package code
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// 消息大小的限制，0表示不限制
+// gob的一次Decode可能包含类型定义和值等多条消息，限制作用于其中的每一条
+type Limits struct {
+	MaxHeaderSize int
+	MaxBodySize   int
+	// 消息过大时关闭连接，否则跳过这条消息(不分配内存)，只让对应的请求失败
+	// header过大时无法确定对应的请求，总是关闭连接
+	CloseOnOversize bool
+}
+
+var ErrMessageTooLarge = errors.New("message too large")
+
+// 读到超过限制的消息时返回，errors.Is(err, ErrMessageTooLarge)为true
+type TooLargeError struct {
+	// "header"或者"body"
+	Part  string
+	Size  uint64
+	Limit int
+	// 为true时连接不能再使用，否则这条消息已经被跳过，可以继续读下一条
+	Fatal bool
+}
+
+func (e *TooLargeError) Error() string {
+	return fmt.Sprintf("[code] %s of %d bytes exceeds the limit of %d bytes", e.Part, e.Size, e.Limit)
+}
+
+func (e *TooLargeError) Unwrap() error {
+	return ErrMessageTooLarge
+}
+
+// 可以设置消息大小限制的编码器，需要在第一次读之前设置
+type Limited interface {
+	SetLimits(l *Limits)
+}
+
+// 按gob的消息格式读取，在把消息交给gob.Decoder之前检查它的长度
+// gob的每条消息前面是一个无符号整数表示的长度：小于128时就是这个字节，
+// 否则第一个字节是长度字节数的相反数，后面是大端序的长度
+// 实现了io.ByteReader，gob.Decoder不会再包一层缓冲，也就不会预读后面的消息
+type limitReader struct {
+	r *bufio.Reader
+	// 当前读取的部分和限制，由编码器在每次Decode前设置
+	part   string
+	limit  int
+	closed bool
+	// 当前消息还没有交给gob的长度前缀和消息体的剩余字节数
+	prefix []byte
+	remain uint64
+	// 致命的错误之后不能再读
+	err error
+}
+
+func newLimitReader(r io.Reader) *limitReader {
+	return &limitReader{r: bufio.NewReader(r)}
+}
+
+func (lr *limitReader) set(part string, limit int, closeOnOversize bool) {
+	lr.part, lr.limit, lr.closed = part, limit, closeOnOversize
+}
+
+func (lr *limitReader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := lr.next(); err != nil {
+		return 0, err
+	}
+	if len(lr.prefix) > 0 {
+		n := copy(p, lr.prefix)
+		lr.prefix = lr.prefix[n:]
+		return n, nil
+	}
+	if uint64(len(p)) > lr.remain {
+		p = p[:lr.remain]
+	}
+	n, err := lr.r.Read(p)
+	lr.remain -= uint64(n)
+	return n, err
+}
+
+func (lr *limitReader) ReadByte() (byte, error) {
+	var b [1]byte
+	if _, err := io.ReadFull(lr, b[:]); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// 在消息边界上读出下一条消息的长度并检查
+func (lr *limitReader) next() error {
+	if lr.err != nil {
+		return lr.err
+	}
+	if len(lr.prefix) > 0 || lr.remain > 0 {
+		return nil
+	}
+	b, err := lr.r.ReadByte()
+	if err != nil {
+		return err
+	}
+	prefix := []byte{b}
+	size := uint64(b)
+	if b >= 0x80 {
+		n := -int(int8(b))
+		if n > 8 {
+			lr.err = fmt.Errorf("[code] invalid gob message length prefix %#x", b)
+			return lr.err
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(lr.r, buf); err != nil {
+			return err
+		}
+		prefix = append(prefix, buf...)
+		size = 0
+		for _, c := range buf {
+			size = size<<8 | uint64(c)
+		}
+	}
+	if lr.limit > 0 && size > uint64(lr.limit) {
+		// header过大时后面的body无法对应到请求，只能关闭连接
+		// 放不进int的长度没法跳过，也只能关闭连接
+		tooLarge := &TooLargeError{Part: lr.part, Size: size, Limit: lr.limit,
+			Fatal: lr.closed || lr.part == "header" || size > math.MaxInt}
+		if tooLarge.Fatal {
+			lr.err = tooLarge
+			return tooLarge
+		}
+		if _, err := lr.r.Discard(int(size)); err != nil {
+			return err
+		}
+		return tooLarge
+	}
+	lr.prefix, lr.remain = prefix, size
+	return nil
+}
@@ -0,0 +1,119 @@
+package code
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// 用gob编码values，返回编码后的数据流
+func gobStream(t *testing.T, values ...interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := gob.NewEncoder(&buf)
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestLimitReader_Prefix(t *testing.T) {
+	// 短消息的长度只有一个字节，长消息的长度前是长度的字节数
+	short, long := "hi", strings.Repeat("x", 300)
+	lr := newLimitReader(bytes.NewReader(gobStream(t, short, long)))
+	lr.set("body", 1024, false)
+	dec := gob.NewDecoder(lr)
+	for _, want := range []string{short, long} {
+		var got string
+		if err := dec.Decode(&got); err != nil || got != want {
+			t.Fatalf("got %d bytes, %v", len(got), err)
+		}
+	}
+	var s string
+	if err := dec.Decode(&s); err != io.EOF {
+		t.Fatalf("expect EOF, got %v", err)
+	}
+}
+
+func TestLimitReader_SkipAndFatal(t *testing.T) {
+	stream := gobStream(t, strings.Repeat("x", 300), "next")
+	t.Run("skip", func(t *testing.T) {
+		lr := newLimitReader(bytes.NewReader(stream))
+		lr.set("body", 100, false)
+		dec := gob.NewDecoder(lr)
+		var s string
+		var tooLarge *TooLargeError
+		err := dec.Decode(&s)
+		if !errors.As(err, &tooLarge) || tooLarge.Fatal || tooLarge.Part != "body" || tooLarge.Limit != 100 ||
+			tooLarge.Size <= 300 || !errors.Is(err, ErrMessageTooLarge) {
+			t.Fatalf("expect a skipped body, got %v", err)
+		}
+		// 过大的消息被跳过，可以继续读下一条
+		if err := dec.Decode(&s); err != nil || s != "next" {
+			t.Fatalf("got %q, %v", s, err)
+		}
+	})
+	for _, tc := range []struct {
+		name            string
+		part            string
+		closeOnOversize bool
+	}{
+		{"close on oversize", "body", true},
+		{"header", "header", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			lr := newLimitReader(bytes.NewReader(stream))
+			lr.set(tc.part, 100, tc.closeOnOversize)
+			dec := gob.NewDecoder(lr)
+			var s string
+			var tooLarge *TooLargeError
+			if err := dec.Decode(&s); !errors.As(err, &tooLarge) || !tooLarge.Fatal {
+				t.Fatalf("expect a fatal error, got %v", err)
+			}
+			// 之后的读取都返回同一个错误
+			lr.set("body", 0, false)
+			if _, err := lr.Read(make([]byte, 1)); !errors.As(err, &tooLarge) {
+				t.Fatalf("expect the fatal error again, got %v", err)
+			}
+		})
+	}
+}
+
+func TestLimitReader_BadSizes(t *testing.T) {
+	t.Run("huge", func(t *testing.T) {
+		// 8字节的长度，超过int的范围，不能跳过
+		data := append([]byte{0xf8}, bytes.Repeat([]byte{0xff}, 8)...)
+		lr := newLimitReader(bytes.NewReader(data))
+		lr.set("body", 100, false)
+		var tooLarge *TooLargeError
+		if _, err := lr.Read(make([]byte, 1)); !errors.As(err, &tooLarge) || !tooLarge.Fatal || tooLarge.Size != 1<<64-1 {
+			t.Fatalf("expect a fatal error, got %v", err)
+		}
+	})
+	t.Run("too many length bytes", func(t *testing.T) {
+		// 0xf7表示长度有9个字节，0x80表示128个字节，都不是合法的gob长度
+		for _, b := range []byte{0xf7, 0x80} {
+			lr := newLimitReader(bytes.NewReader([]byte{b, 1, 2, 3}))
+			lr.set("body", 100, false)
+			_, err := lr.Read(make([]byte, 1))
+			if err == nil || !strings.Contains(err.Error(), "invalid gob message length") {
+				t.Fatalf("%#x: expect an invalid prefix error, got %v", b, err)
+			}
+			if _, again := lr.Read(make([]byte, 1)); again != err {
+				t.Fatalf("%#x: expect the same error, got %v", b, again)
+			}
+		}
+	})
+	t.Run("truncated", func(t *testing.T) {
+		lr := newLimitReader(bytes.NewReader([]byte{0xfe, 0x01}))
+		lr.set("body", 100, false)
+		if _, err := lr.Read(make([]byte, 1)); err != io.ErrUnexpectedEOF {
+			t.Fatalf("expect ErrUnexpectedEOF, got %v", err)
+		}
+	})
+}
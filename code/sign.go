@@ -0,0 +1,47 @@
+package code
+
+import (
+	"crypto/rand"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 签名使用的密钥
+type SigningKey struct {
+	ID     string
+	Secret []byte
+}
+
+// 给写出的每条消息签名，读取时不校验
+// body先用连接的编码器EncodeValue编码，签名覆盖header和编码后的body
+type SigningCode struct {
+	irpc.ICode
+	key *SigningKey
+}
+
+func NewSigningCode(cc irpc.ICode, key *SigningKey) irpc.ICode {
+	return &SigningCode{ICode: cc, key: key}
+}
+
+func (sc *SigningCode) Write(header *irpc.Header, body interface{}) error {
+	var raw []byte
+	if body != nil {
+		var err error
+		if raw, err = sc.ICode.EncodeValue(body); err != nil {
+			return err
+		}
+	}
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	// 复制一份，调用方可能复用header
+	h := *header
+	h.Sign = &irpc.Signature{
+		KeyID:     sc.key.ID,
+		Timestamp: time.Now().UnixNano(),
+		Nonce:     nonce,
+	}
+	h.Sign.MAC = irpc.SignMAC(sc.key.Secret, &h, raw)
+	return sc.ICode.Write(&h, raw)
+}
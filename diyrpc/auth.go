@@ -0,0 +1,208 @@
+package diyrpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"io"
+	"tinyRPCFramwork/irpc"
+)
+
+// 认证方式
+const (
+	AuthBearer = "bearer"
+	AuthHMAC   = "hmac"
+	// 双向TLS中客户端证书的身份
+	AuthTLS = "tls"
+)
+
+// 客户端的凭证，随Option发送
+type Credentials struct {
+	Scheme string
+	// bearer的token
+	Token string `json:",omitempty"`
+	// hmac使用的密钥ID
+	KeyID string `json:",omitempty"`
+	// 计算服务端challenge的响应，只在客户端使用，不发送
+	Respond func(challenge []byte) ([]byte, error) `json:"-"`
+}
+
+func BearerCredentials(token string) *Credentials {
+	return &Credentials{Scheme: AuthBearer, Token: token}
+}
+
+// 使用共享密钥的challenge-response，密钥不会出现在连接上
+func HMACCredentials(keyID string, secret []byte) *Credentials {
+	return &Credentials{
+		Scheme: AuthHMAC,
+		KeyID:  keyID,
+		Respond: func(challenge []byte) ([]byte, error) {
+			return HMACResponse(secret, challenge), nil
+		},
+	}
+}
+
+func HMACResponse(secret, challenge []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(challenge)
+	return mac.Sum(nil)
+}
+
+// 认证通过的客户端身份
+type Identity struct {
+	// 认证方式，如AuthBearer
+	Scheme string
+	// 客户端是谁，如token对应的用户或者密钥ID
+	Subject string
+	// 认证器给出的角色，授权策略中用"role:角色名"匹配
+	Roles []string
+	// 双向TLS时客户端的证书，没有时为nil
+	Certificate *x509.Certificate
+}
+
+// 握手时认证客户端
+// challenge把数据发给客户端并返回客户端的响应，不需要challenge的认证方式可以不调用
+// 返回带错误码的错误时使用该错误码，否则使用CodeUnauthenticated
+type Authenticator interface {
+	Authenticate(cred *Credentials, challenge func([]byte) ([]byte, error)) (*Identity, error)
+}
+
+// 设置认证器，之后建立的连接必须通过认证，为空时不认证
+func (s *Server) SetAuthenticator(a Authenticator) {
+	if a == nil {
+		s.auth.Store(nil)
+		return
+	}
+	s.auth.Store(&a)
+}
+
+// 握手中Option之后的消息，使用json编码
+// 服务端发送Challenge或者最终结果，客户端发送Response
+type AuthMessage struct {
+	Challenge []byte `json:",omitempty"`
+	Response  []byte `json:",omitempty"`
+	// 认证结束，Error为空表示通过
+	Done  bool      `json:",omitempty"`
+	Error string    `json:",omitempty"`
+	Code  irpc.Code `json:",omitempty"`
+}
+
+// 客户端会读取握手结果时在Option之后返回结果，没有设置认证器时直接通过，
+// 认证失败时客户端的Dial返回服务端给出的错误。
+// 不读取结果的旧客户端不能认证，设置了认证器时直接关闭连接
+func (s *Server) authenticate(dec *json.Decoder, w io.Writer, opt *Option) (*Identity, error) {
+	auth := s.auth.Load()
+	if !opt.expectsResult() {
+		if auth != nil {
+			return nil, irpc.NewError(irpc.CodeUnauthenticated, "[rpc server] authentication failed: client can't read the handshake result")
+		}
+		return nil, nil
+	}
+	enc := json.NewEncoder(w)
+	var id *Identity
+	var err error
+	if auth != nil {
+		cred := opt.Credentials
+		if cred == nil {
+			cred = new(Credentials)
+		}
+		id, err = (*auth).Authenticate(cred, func(challenge []byte) ([]byte, error) {
+			if err := enc.Encode(&AuthMessage{Challenge: challenge}); err != nil {
+				return nil, err
+			}
+			var msg AuthMessage
+			if err := dec.Decode(&msg); err != nil {
+				return nil, err
+			}
+			return msg.Response, nil
+		})
+		if err == nil && id == nil {
+			id = &Identity{}
+		}
+	}
+	if err != nil {
+		code := irpc.CodeUnauthenticated
+		var e *irpc.Error
+		if errors.As(err, &e) {
+			code = e.Code
+		}
+		err = irpc.NewError(code, "[rpc server] authentication failed: "+err.Error())
+	}
+	if werr := writeHandshakeResult(w, err); werr != nil && err == nil {
+		err = werr
+	}
+	return id, err
+}
+
+// 客户端是否会读取握手结果，旧客户端只在发送了凭证时读取
+func (opt *Option) expectsResult() bool {
+	return opt.HandshakeResult || opt.Credentials != nil
+}
+
+// 发送握手的最终结果，err不为空时拒绝连接
+func writeHandshakeResult(w io.Writer, err error) error {
+	result := &AuthMessage{Done: true}
+	if err != nil {
+		result.Error = err.Error()
+		result.Code = irpc.CodeOf(err)
+	}
+	return json.NewEncoder(w).Encode(result)
+}
+
+// bearer token认证，Tokens是token到Subject的映射
+type TokenAuthenticator struct {
+	Tokens map[string]string
+}
+
+func (a *TokenAuthenticator) Authenticate(cred *Credentials, _ func([]byte) ([]byte, error)) (*Identity, error) {
+	if cred.Scheme != AuthBearer {
+		return nil, irpc.NewError(irpc.CodeUnauthenticated, "bearer token required")
+	}
+	// 逐个比较，不在map中直接查找，避免比较时间泄露token
+	for token, subject := range a.Tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(cred.Token)) == 1 {
+			return &Identity{Scheme: AuthBearer, Subject: subject}, nil
+		}
+	}
+	return nil, irpc.NewError(irpc.CodeUnauthenticated, "invalid token")
+}
+
+// hmac challenge-response认证，Secrets是密钥ID到密钥的映射，Subject是密钥ID
+type HMACAuthenticator struct {
+	Secrets map[string][]byte
+}
+
+func (a *HMACAuthenticator) Authenticate(cred *Credentials, challenge func([]byte) ([]byte, error)) (*Identity, error) {
+	if cred.Scheme != AuthHMAC {
+		return nil, irpc.NewError(irpc.CodeUnauthenticated, "hmac credentials required")
+	}
+	secret, ok := a.Secrets[cred.KeyID]
+	if !ok {
+		return nil, irpc.NewError(irpc.CodeUnauthenticated, "unknown key id "+cred.KeyID)
+	}
+	nonce := make([]byte, 32)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, irpc.NewError(irpc.CodeInternal, err.Error())
+	}
+	response, err := challenge(nonce)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(response, HMACResponse(secret, nonce)) {
+		return nil, irpc.NewError(irpc.CodeUnauthenticated, "invalid hmac response")
+	}
+	return &Identity{Scheme: AuthHMAC, Subject: cred.KeyID}, nil
+}
+
+type identityKey struct{}
+
+// 返回处理请求的连接上认证通过的身份，服务端没有设置认证器时返回nil
+func IdentityFromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(identityKey{}).(*Identity)
+	return id
+}
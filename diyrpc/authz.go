@@ -0,0 +1,246 @@
+package diyrpc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"sync/atomic"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 决定身份id能否调用serviceMethod，id为空表示没有认证
+// 返回不带错误码的错误时使用CodePermissionDenied
+type Authorizer interface {
+	Authorize(id *Identity, serviceMethod string) error
+}
+
+// 设置授权器，之后的每个请求(包括批量调用中的每个请求)都要通过授权，为空时不检查
+func (s *Server) SetAuthorizer(a Authorizer) {
+	if a == nil {
+		s.authz.Store(nil)
+		return
+	}
+	s.authz.Store(&a)
+}
+
+func (s *Server) authorize(id *Identity, serviceMethod string) error {
+	a := s.authz.Load()
+	if a == nil {
+		return nil
+	}
+	err := (*a).Authorize(id, serviceMethod)
+	if err == nil {
+		return nil
+	}
+	var e *irpc.Error
+	if errors.As(err, &e) {
+		return err
+	}
+	return irpc.NewError(irpc.CodePermissionDenied, "[rpc server] permission denied: "+err.Error())
+}
+
+// 授权策略，一般从json文件中读取：
+//
+//	{
+//	  "default": "deny",
+//	  "roles": {"alice": ["admin"]},
+//	  "rules": [
+//	    {"methods": ["Admin.*"], "allow": ["role:admin"]},
+//	    {"methods": ["Arith.*", "diyrpc.Describe"], "allow": ["*"], "deny": ["mallory"]}
+//	  ]
+//	}
+//
+// methods使用path.Match的模式匹配"服务名.方法名"
+// allow和deny中的主体可以是身份的Subject、"role:角色名"或者表示任何调用方的"*"，
+// 没有认证的调用方只匹配"*"
+// 匹配方法的规则中有deny匹配时拒绝，否则有allow匹配时允许，都不匹配时使用default
+type Policy struct {
+	// "allow"或者"deny"，为空时是deny
+	Default string `json:"default"`
+	// Subject到角色的映射，和Identity.Roles合并
+	Roles map[string][]string `json:"roles"`
+	Rules []Rule              `json:"rules"`
+}
+
+type Rule struct {
+	Methods []string `json:"methods"`
+	Allow   []string `json:"allow"`
+	Deny    []string `json:"deny"`
+}
+
+const rolePrefix = "role:"
+
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("parse policy: %v", err)
+	}
+	if p.Default != "" && p.Default != "allow" && p.Default != "deny" {
+		return nil, fmt.Errorf("parse policy: default must be allow or deny, got %q", p.Default)
+	}
+	for i, r := range p.Rules {
+		if len(r.Methods) == 0 {
+			return nil, fmt.Errorf("parse policy: rule %d has no methods", i)
+		}
+		for _, m := range r.Methods {
+			if _, err := path.Match(m, ""); err != nil {
+				return nil, fmt.Errorf("parse policy: rule %d: bad pattern %q", i, m)
+			}
+		}
+	}
+	return &p, nil
+}
+
+func (p *Policy) Authorize(id *Identity, serviceMethod string) error {
+	allowed := false
+	for _, r := range p.Rules {
+		if !r.match(serviceMethod) {
+			continue
+		}
+		if p.matchAny(id, r.Deny) {
+			return irpc.NewError(irpc.CodePermissionDenied, "[rpc server] permission denied: "+p.who(id)+" is denied "+serviceMethod)
+		}
+		if p.matchAny(id, r.Allow) {
+			allowed = true
+		}
+	}
+	if allowed || p.Default == "allow" {
+		return nil
+	}
+	return irpc.NewError(irpc.CodePermissionDenied, "[rpc server] permission denied: "+p.who(id)+" is not allowed "+serviceMethod)
+}
+
+func (r *Rule) match(serviceMethod string) bool {
+	for _, m := range r.Methods {
+		if ok, _ := path.Match(m, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) matchAny(id *Identity, principals []string) bool {
+	for _, principal := range principals {
+		if principal == "*" {
+			return true
+		}
+		if id == nil {
+			continue
+		}
+		if role := strings.TrimPrefix(principal, rolePrefix); role != principal {
+			if p.hasRole(id, role) {
+				return true
+			}
+		} else if principal == id.Subject {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) hasRole(id *Identity, role string) bool {
+	for _, r := range id.Roles {
+		if r == role {
+			return true
+		}
+	}
+	for _, r := range p.Roles[id.Subject] {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) who(id *Identity) string {
+	if id == nil {
+		return "anonymous"
+	}
+	return id.Subject
+}
+
+// 从文件读取策略，文件修改后可以重新加载，加载失败时继续使用原来的策略
+type PolicyAuthorizer struct {
+	file   string
+	policy atomic.Pointer[Policy]
+	// 上次加载的文件的修改时间
+	modTime atomic.Int64
+	// Watch中重新加载的日志，为空时使用irpc.DefaultLogger
+	logger irpc.Logger
+}
+
+func NewPolicyAuthorizer(file string) (*PolicyAuthorizer, error) {
+	a := &PolicyAuthorizer{file: file}
+	if err := a.Reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *PolicyAuthorizer) Authorize(id *Identity, serviceMethod string) error {
+	return a.policy.Load().Authorize(id, serviceMethod)
+}
+
+// 需要在Watch之前设置
+func (a *PolicyAuthorizer) SetLogger(l irpc.Logger) {
+	a.logger = l
+}
+
+func (a *PolicyAuthorizer) Policy() *Policy {
+	return a.policy.Load()
+}
+
+// 重新读取策略文件
+func (a *PolicyAuthorizer) Reload() error {
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	p, err := ParsePolicy(data)
+	if err != nil {
+		return fmt.Errorf("%s: %v", a.file, err)
+	}
+	a.policy.Store(p)
+	a.modTime.Store(info.ModTime().UnixNano())
+	return nil
+}
+
+// 每隔interval检查文件的修改时间，修改后重新加载，调用返回的函数停止检查
+func (a *PolicyAuthorizer) Watch(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	logger := irpc.With(irpc.LoggerOr(a.logger), "component", "authz", "file", a.file)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+			info, err := os.Stat(a.file)
+			if err != nil || info.ModTime().UnixNano() == a.modTime.Load() {
+				continue
+			}
+			if err := a.Reload(); err != nil {
+				logger.Error("reload policy failed, keep the old one", "err", err)
+				// 同一个修改不重复报错
+				a.modTime.Store(info.ModTime().UnixNano())
+				continue
+			}
+			logger.Info("policy reloaded")
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,134 @@
+package diyrpc
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+const testPolicy = `{
+	"default": "deny",
+	"roles": {"alice": ["admin"]},
+	"rules": [
+		{"methods": ["Admin.*"], "allow": ["role:admin"]},
+		{"methods": ["Whoami.*"], "allow": ["*"], "deny": ["mallory"]}
+	]
+}`
+
+func TestParsePolicy(t *testing.T) {
+	if _, err := ParsePolicy([]byte(testPolicy)); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		name, policy, err string
+	}{
+		{"bad default", `{"default": "maybe"}`, "default must be allow or deny"},
+		{"no methods", `{"rules": [{"allow": ["*"]}]}`, "rule 0 has no methods"},
+		{"bad pattern", `{"rules": [{"methods": ["["]}]}`, `bad pattern "["`},
+		{"unknown field", `{"rule": []}`, "unknown field"},
+		{"not json", `default: deny`, "parse policy"},
+	}
+	for _, tc := range cases {
+		if _, err := ParsePolicy([]byte(tc.policy)); err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: expect %q, got %v", tc.name, tc.err, err)
+		}
+	}
+}
+
+func TestPolicy_Authorize(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice := &Identity{Subject: "alice"}
+	bob := &Identity{Subject: "bob"}
+	carol := &Identity{Subject: "carol", Roles: []string{"admin"}}
+	mallory := &Identity{Subject: "mallory"}
+	cases := []struct {
+		id     *Identity
+		method string
+		allow  bool
+	}{
+		// 策略中的角色
+		{alice, "Admin.Reset", true},
+		// 身份自带的角色
+		{carol, "Admin.Reset", true},
+		{bob, "Admin.Reset", false},
+		{bob, "Whoami.Me", true},
+		// deny优先于allow
+		{mallory, "Whoami.Me", false},
+		// 没有认证的调用方只匹配"*"
+		{nil, "Whoami.Me", true},
+		{nil, "Admin.Reset", false},
+		// 没有规则匹配时使用default
+		{alice, DescribeMethod, false},
+	}
+	for _, tc := range cases {
+		err := p.Authorize(tc.id, tc.method)
+		if (err == nil) != tc.allow {
+			t.Errorf("%s %s: expect allow=%v, got %v", p.who(tc.id), tc.method, tc.allow, err)
+		}
+		if err != nil && irpc.CodeOf(err) != irpc.CodePermissionDenied {
+			t.Errorf("%s %s: expect PermissionDenied, got %s", p.who(tc.id), tc.method, irpc.CodeOf(err))
+		}
+	}
+	p.Default = "allow"
+	if err := p.Authorize(alice, DescribeMethod); err != nil {
+		t.Fatalf("expect the default to allow, got %v", err)
+	}
+}
+
+// 指定修改时间，避免两次写入的修改时间相同
+func writePolicy(t *testing.T, file, policy string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(file, []byte(policy), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(file, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPolicyAuthorizer_Reload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.json")
+	if _, err := NewPolicyAuthorizer(file); err == nil {
+		t.Fatal("expect an error for a missing file")
+	}
+	writePolicy(t, file, testPolicy, time.Now())
+	a, err := NewPolicyAuthorizer(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.SetLogger(irpc.NopLogger{})
+	alice := &Identity{Subject: "alice"}
+	bob := &Identity{Subject: "bob"}
+
+	// 坏的策略不会替换原来的策略
+	writePolicy(t, file, `{"rules": [{"methods": ["["]}]}`, time.Now().Add(time.Second))
+	if err := a.Reload(); err == nil || !strings.Contains(err.Error(), file) {
+		t.Fatalf("expect the parse error with the file name, got %v", err)
+	}
+	if err := a.Authorize(alice, "Admin.Reset"); err != nil {
+		t.Fatalf("old policy should stay: %v", err)
+	}
+
+	stop := a.Watch(10 * time.Millisecond)
+	defer stop()
+	writePolicy(t, file, `{"rules": [{"methods": ["Admin.*"], "allow": ["bob"]}]}`, time.Now().Add(2*time.Second))
+	deadline := time.Now().Add(time.Second)
+	for a.Authorize(bob, "Admin.Reset") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("policy not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if a.Authorize(alice, "Admin.Reset") == nil {
+		t.Fatal("alice should be denied by the new policy")
+	}
+	if len(a.Policy().Rules) != 1 {
+		t.Fatalf("unexpected policy %+v", a.Policy())
+	}
+}
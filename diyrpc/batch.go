@@ -0,0 +1,97 @@
+package diyrpc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+// 执行批量调用，所有请求完成后一起返回结果
+// 整个批量共用一个ctx，超时时返回DeadlineExceeded，不返回部分结果
+func (s *Server) handleBatch(ctx context.Context, code irpc.ICode, logger irpc.Logger, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
+	defer wg.Done()
+	calls := req.batch.Calls
+	resp := &irpc.BatchResponse{Results: make([]irpc.BatchResult, len(calls))}
+	finished := make(chan struct{})
+	go func() {
+		defer close(finished)
+		if req.batch.Ordered {
+			for i := range calls {
+				resp.Results[i] = s.batchCall(ctx, code, &calls[i])
+			}
+			return
+		}
+		var calling sync.WaitGroup
+		for i := range calls {
+			calling.Add(1)
+			go func(i int) {
+				defer calling.Done()
+				resp.Results[i] = s.batchCall(ctx, code, &calls[i])
+			}(i)
+		}
+		calling.Wait()
+	}()
+	select {
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			return
+		}
+		atomic.AddUint64(&s.stats.timeouts, 1)
+		req.h.Error = fmt.Sprintf("[rpc server] batch handle timeout:expect within %s", timeout)
+		req.h.Code = irpc.CodeDeadlineExceeded
+		s.sendResponse(code, logger, req.h, invalidRequest, sending)
+	case <-finished:
+		s.sendResponse(code, logger, req.h, resp, sending)
+	}
+}
+
+// 执行批量调用中的一个请求，批量调用只支持普通方法
+// 参数和返回值用连接的编码器编解码
+func (s *Server) batchCall(ctx context.Context, code irpc.ICode, call *irpc.BatchCall) irpc.BatchResult {
+	finish := s.metrics.Start(s.methodLabel(call.ServiceMethod))
+	r := s.doBatchCall(ctx, code, call)
+	finish(r.Code)
+	return r
+}
+
+func (s *Server) doBatchCall(ctx context.Context, code irpc.ICode, call *irpc.BatchCall) irpc.BatchResult {
+	result := func(err error) irpc.BatchResult {
+		atomic.AddUint64(&s.stats.errors, 1)
+		return irpc.BatchResult{Error: err.Error(), Code: irpc.CodeOf(err)}
+	}
+	if ctx.Err() != nil {
+		return result(irpc.NewError(irpc.CodeCanceled, "[rpc server] batch call skipped:"+ctx.Err().Error()))
+	}
+	if err := s.authorize(IdentityFromContext(ctx), call.ServiceMethod); err != nil {
+		return result(err)
+	}
+	svc, mType, err := s.findService(call.ServiceMethod)
+	if err != nil {
+		return result(err)
+	}
+	if mType.Streaming != service.Unary {
+		return result(irpc.NewError(irpc.CodeInvalidArgument, "[rpc server] streaming method can't be batched:"+call.ServiceMethod))
+	}
+	argv := mType.NewArgv()
+	argvi := argv.Interface()
+	if argv.Type().Kind() != reflect.Ptr {
+		argvi = argv.Addr().Interface()
+	}
+	if err := code.DecodeValue(call.Args, argvi); err != nil {
+		return result(irpc.NewError(irpc.CodeInvalidArgument, "[rpc server] read batch argv faild:"+err.Error()))
+	}
+	replyv := mType.NewReply()
+	if err := svc.CallContext(ctx, mType, argv, replyv); err != nil {
+		return result(err)
+	}
+	reply, err := code.EncodeValue(replyv.Interface())
+	if err != nil {
+		return result(irpc.NewError(irpc.CodeInternal, "[rpc server] encode batch reply faild:"+err.Error()))
+	}
+	return irpc.BatchResult{Reply: reply}
+}
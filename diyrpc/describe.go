@@ -0,0 +1,64 @@
+package diyrpc
+
+import (
+	"reflect"
+	"sort"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+// 查询服务方法集合的内置方法，参数是服务名，返回ServiceDesc
+// 服务名diyrpc不是公开的名字，不会和通过Register注册的服务冲突
+const DescribeMethod = "diyrpc.Describe"
+
+type ServiceDesc struct {
+	Name    string
+	Methods []MethodDesc
+}
+
+// 流方法的ArgType和ReplyType是每条消息的类型，和service.MethodType相同
+type MethodDesc struct {
+	Name      string
+	ArgType   string
+	ReplyType string
+	// reflect.Kind的名字，指针会先取元素类型，客户端用它判断类型是否兼容
+	ArgKind   string
+	ReplyKind string
+	Streaming service.StreamKind
+}
+
+type describer struct {
+	s *Server
+}
+
+func (d *describer) Describe(name string, reply *ServiceDesc) error {
+	svc, ok := d.s.serviceMap.Load(name)
+	if !ok {
+		return irpc.NewError(irpc.CodeNotFound, "[rpc server] can't find service"+name)
+	}
+	s := svc.(*service.Service)
+	reply.Name = s.Name
+	for methodName, mt := range s.Method {
+		reply.Methods = append(reply.Methods, MethodDesc{
+			Name:      methodName,
+			ArgType:   mt.ArgType.String(),
+			ReplyType: mt.ReplyType.String(),
+			ArgKind:   KindOf(mt.ArgType),
+			ReplyKind: KindOf(mt.ReplyType),
+			Streaming: mt.Streaming,
+		})
+	}
+	sort.Slice(reply.Methods, func(i, j int) bool {
+		return reply.Methods[i].Name < reply.Methods[j].Name
+	})
+	return nil
+}
+
+// 类型的Kind，指针取元素类型
+// 参数和reply是否通过指针传递不影响编码，比较时忽略
+func KindOf(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Kind().String()
+}
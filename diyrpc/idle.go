@@ -0,0 +1,26 @@
+package diyrpc
+
+import (
+	"net"
+	"time"
+)
+
+// 设置连接的空闲超时，之后建立的连接超过d没有收到任何消息(包括心跳)时不再读取请求，
+// 正在处理的请求和流被取消，方法返回后关闭连接，避免对端已经消失的半开连接一直占用serveCode的goroutine
+// 需要保持空闲连接的客户端应该开启心跳，见Option.Heartbeat
+func (s *Server) SetIdleTimeout(d time.Duration) {
+	s.idleTimeout.Store(int64(d))
+}
+
+// 每次读取前把读超时推迟到timeout之后
+type idleConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+func (c *idleConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(p)
+}
@@ -0,0 +1,12 @@
+package diyrpc
+
+import "tinyRPCFramwork/code"
+
+// 握手阶段json解码器最多读取的字节数
+const maxHandshakeSize = 64 << 10
+
+// 设置之后建立的连接上请求的header和body的大小限制
+// body过大时这个请求返回CodeResourceExhausted，l.CloseOnOversize为true或者header过大时关闭连接
+func (s *Server) SetLimits(l *code.Limits) {
+	s.limits.Store(l)
+}
@@ -0,0 +1,169 @@
+package diyrpc
+
+import (
+	"context"
+	"sync"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 双向连接的另一端，服务端通过它调用客户端注册的服务
+// 调用和响应与客户端发起的调用共用一个连接，消息头中带Reverse标记
+type Peer struct {
+	code    irpc.ICode
+	sending *sync.Mutex
+
+	mu      sync.Mutex
+	seq     uint64
+	pending map[uint64]*peerCall
+	closed  bool
+	// 连接断开后关闭
+	done chan struct{}
+	// 握手时认证通过的身份
+	id *Identity
+}
+
+type peerCall struct {
+	reply interface{}
+	err   chan error
+}
+
+var ErrPeerClosed = irpc.NewError(irpc.CodeUnavailable, "[rpc server] peer connection closed")
+
+func newPeer(code irpc.ICode, sending *sync.Mutex) *Peer {
+	return &Peer{
+		code:    code,
+		sending: sending,
+		seq:     1,
+		pending: make(map[uint64]*peerCall),
+		done:    make(chan struct{}),
+	}
+}
+
+type peerKey struct{}
+
+// 返回双向连接上处理请求时的Peer，普通连接返回nil
+func PeerFromContext(ctx context.Context) *Peer {
+	p, _ := ctx.Value(peerKey{}).(*Peer)
+	return p
+}
+
+// 返回连接认证通过的身份，服务端没有设置认证器时返回nil
+func (p *Peer) Identity() *Identity {
+	return p.id
+}
+
+// 之后建立双向连接时调用fn，fn在单独的goroutine中执行，为空时不调用
+func (s *Server) OnPeer(fn func(p *Peer)) {
+	if fn == nil {
+		s.onPeer.Store(nil)
+		return
+	}
+	s.onPeer.Store(&fn)
+}
+
+// 调用客户端注册的方法，ctx的截止时间会发给客户端，ctx结束时通知客户端取消
+func (p *Peer) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	if ctx.Err() != nil {
+		return irpc.ContextError(ctx, "[rpc server] peer call failed")
+	}
+	call := &peerCall{reply: reply, err: make(chan error, 1)}
+	seq, err := p.register(call)
+	if err != nil {
+		return err
+	}
+	h := &irpc.Header{
+		ServiceMethod: serviceMethod,
+		Seq:           seq,
+		Reverse:       true,
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		h.Timeout = time.Until(deadline)
+	}
+	if err := p.write(h, args); err != nil {
+		p.remove(seq)
+		return irpc.NewError(irpc.CodeUnavailable, err.Error())
+	}
+	select {
+	case <-ctx.Done():
+		if p.remove(seq) != nil {
+			go func() {
+				_ = p.write(&irpc.Header{Seq: seq, Kind: irpc.KindCancel, Reverse: true}, invalidRequest)
+			}()
+		}
+		return irpc.ContextError(ctx, "[rpc server] peer call failed")
+	case err := <-call.err:
+		return err
+	}
+}
+
+// 连接断开后关闭
+func (p *Peer) Done() <-chan struct{} {
+	return p.done
+}
+
+// 关闭连接，客户端发起的调用也会结束
+func (p *Peer) Close() error {
+	return p.code.Close()
+}
+
+func (p *Peer) register(call *peerCall) (uint64, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, ErrPeerClosed
+	}
+	seq := p.seq
+	p.seq++
+	p.pending[seq] = call
+	return seq, nil
+}
+
+func (p *Peer) remove(seq uint64) *peerCall {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	call := p.pending[seq]
+	delete(p.pending, seq)
+	return call
+}
+
+func (p *Peer) write(h *irpc.Header, body interface{}) error {
+	p.sending.Lock()
+	defer p.sending.Unlock()
+	return p.code.Write(h, body)
+}
+
+// 读取客户端返回的响应，返回读body的错误
+func (p *Peer) receive(code irpc.ICode, h *irpc.Header) error {
+	call := p.remove(h.Seq)
+	switch {
+	case call == nil:
+		return code.ReadBody(nil)
+	case h.Error != "":
+		call.err <- irpc.HeaderError(h)
+		return code.ReadBody(nil)
+	default:
+		err := code.ReadBody(call.reply)
+		if err != nil {
+			call.err <- irpc.NewError(irpc.CodeInternal, "[rpc server] reading body "+err.Error())
+		} else {
+			call.err <- nil
+		}
+		return err
+	}
+}
+
+// 连接断开，结束所有未完成的调用
+func (p *Peer) terminate() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return
+	}
+	p.closed = true
+	close(p.done)
+	for seq, call := range p.pending {
+		call.err <- ErrPeerClosed
+		delete(p.pending, seq)
+	}
+}
@@ -1,17 +1,22 @@
 package diyrpc
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"reflect"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
+	"tinyRPCFramwork/code"
 	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/metrics"
 	"tinyRPCFramwork/service"
 )
 
@@ -23,6 +28,27 @@ type Option struct {
 	CodeType          irpc.Type
 	ConnectionTimeout time.Duration
 	HandleTimeout     time.Duration
+	// 客户端也注册了服务，服务端可以通过同一个连接调用客户端
+	Bidirectional bool
+	// 客户端的凭证，服务端设置了认证器时在握手中校验
+	Credentials *Credentials `json:",omitempty"`
+	// 客户端会在Option之后读取握手结果，服务端总是返回结果，拒绝连接时客户端能得到原因；
+	// 没有设置的旧客户端只在发送了凭证时读取结果，其余情况服务端不返回，直接开始收发消息
+	HandshakeResult bool `json:",omitempty"`
+	// 客户端使用TLS连接，ServerName为空时使用拨号地址中的主机名
+	TLSConfig *tls.Config `json:"-"`
+	// 不为空时客户端给每条消息签名，见Server.SetSigning
+	SigningKey *code.SigningKey `json:"-"`
+	// 客户端读取响应时的消息大小限制，为空时不限制
+	Limits *code.Limits `json:"-"`
+	// 客户端在Heartbeat时间内没有收到任何消息时发送心跳，0表示不发送
+	Heartbeat time.Duration
+	// 超过这个时间没有收到任何消息时断开连接，默认是Heartbeat的3倍
+	HeartbeatTimeout time.Duration
+	// 客户端和它的编码器使用的Logger，为空时使用irpc.DefaultLogger
+	Logger irpc.Logger `json:"-"`
+	// 记录客户端的指标，见metrics.NewClientMetrics，为空时不记录
+	Metrics *metrics.RPCMetrics `json:"-"`
 }
 
 var invalidRequest = struct{}{}
@@ -31,6 +57,7 @@ var DefaultOption = &Option{
 	MarkedDiyrpc:      MarkDiyrpc,
 	CodeType:          irpc.GobType,
 	ConnectionTimeout: time.Second * 10,
+	HandshakeResult:   true,
 }
 
 type request struct {
@@ -38,6 +65,12 @@ type request struct {
 	argv, reply reflect.Value
 	mType       *service.MethodType
 	svc         *service.Service
+	// 服务端流方法的发送端
+	stream *serverStream
+	// 批量调用
+	batch *irpc.BatchRequest
+	// 快速路径的参数和reply，从池中取，处理完放回
+	argp, replyp interface{}
 }
 
 // 采用json编码option，拿到option中的编码方式之后
@@ -45,10 +78,35 @@ type request struct {
 
 type Server struct {
 	serviceMap sync.Map
+	stats      serverStats
+	// 以下配置都可以在运行时替换，只影响之后建立的连接
+	// 建立双向连接时调用
+	onPeer atomic.Pointer[func(*Peer)]
+	// 握手时认证客户端，为空时不认证
+	auth atomic.Pointer[Authenticator]
+	// 检查请求能否调用方法，为空时不检查，可以在运行时替换
+	authz atomic.Pointer[Authorizer]
+	// 不为空时连接使用TLS
+	tlsConfig atomic.Pointer[tls.Config]
+	// 校验请求签名，为空时不要求签名
+	signing atomic.Pointer[Signing]
+	nonces  nonceCache
+	// 连接上超过这个时间没有收到消息时关闭连接，0表示不限制
+	idleTimeout atomic.Int64
+	// 消息大小的限制，为空时不限制
+	limits atomic.Pointer[code.Limits]
+	// 为空时使用irpc.DefaultLogger
+	logger irpc.Logger
+	// 为空时不记录指标
+	metrics *metrics.RPCMetrics
 }
 
-func NewServer() irpc.IServer {
-	return &Server{}
+var _ irpc.IServer = (*Server)(nil)
+
+func NewServer() *Server {
+	s := &Server{}
+	_ = s.RegisterName("diyrpc", &describer{s: s})
+	return s
 }
 
 var DefaultServer = NewServer()
@@ -57,6 +115,10 @@ func (s *Server) Accept(listener net.Listener) {
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
+			// listener关闭后不再接受连接
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
 			continue
 		}
 		go s.ServeConn(conn)
@@ -65,32 +127,174 @@ func (s *Server) Accept(listener net.Listener) {
 func Accept(listener net.Listener) {
 	DefaultServer.Accept(listener)
 }
+
+// 设置服务端和连接上编码器的Logger，需要在处理连接之前设置
+func (s *Server) SetLogger(l irpc.Logger) {
+	s.logger = l
+}
+
+func (s *Server) log() irpc.Logger {
+	return irpc.LoggerOr(s.logger)
+}
+
 func (s *Server) ServeConn(conn net.Conn) {
 	defer func() { conn.Close() }()
+	// 连接上的日志都带上客户端地址
+	logger := irpc.With(s.log(), "component", "server", "remote", conn.RemoteAddr().String())
+	conn = s.metrics.Conn(conn)
+	// 整个握手(TLS、Option和认证)使用默认的连接超时时间，
+	// 避免连上后不发送数据的连接一直占用goroutine
+	if err := conn.SetDeadline(time.Now().Add(DefaultOption.ConnectionTimeout)); err != nil {
+		logger.Warn("set handshake deadline failed", "err", err)
+		return
+	}
+	cert, err := s.handshakeTLS(&conn)
+	if err != nil {
+		logger.Warn("tls handshake failed", "err", err)
+		return
+	}
 	var opt Option
-	if err := json.NewDecoder(conn).Decode(&opt); err != nil {
-		log.Println("json.NewDecoder(conn).Decode err", err)
+	// Option和认证消息都很小，限制json解码器最多读取的数据
+	dec := json.NewDecoder(io.LimitReader(conn, maxHandshakeSize))
+	if err := dec.Decode(&opt); err != nil {
+		logger.Warn("decode option failed", "err", err)
 		return
 	}
 	if opt.MarkedDiyrpc != MarkDiyrpc {
-		log.Println("invalid MarkedDiyrpc")
+		logger.Warn("invalid magic number", "mark", opt.MarkedDiyrpc)
 		return
 	}
 	f := irpc.NewCodeFuncMap[opt.CodeType]
 	if f == nil {
-		log.Println("[rpc server]: invaild code type!", opt.CodeType)
+		logger.Warn("invalid code type", "type", opt.CodeType)
+		if opt.expectsResult() {
+			_ = writeHandshakeResult(conn, irpc.Errorf(irpc.CodeInvalidArgument, "[rpc server] invalid code type %s", opt.CodeType))
+		}
+		return
+	}
+	id, err := s.authenticate(dec, conn, &opt)
+	if err != nil {
+		logger.Warn("authentication failed", "err", err)
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
 		return
 	}
+	if timeout := time.Duration(s.idleTimeout.Load()); timeout > 0 {
+		conn = &idleConn{Conn: conn, timeout: timeout}
+	}
+	// 没有认证器时使用客户端证书作为身份
+	if cert != nil {
+		if id == nil {
+			id = &Identity{Scheme: AuthTLS, Subject: cert.Subject.CommonName}
+		}
+		id.Certificate = cert
+	}
 	// f是对应编码方法类的构造函数
-	s.serveCode(f(conn))
+	// json解码时可能多读了后面的数据，需要先把这部分交给编码器
+	// json.Encoder会在option后面写一个换行符，要跳过它
+	r := bufio.NewReader(io.MultiReader(dec.Buffered(), conn))
+	if b, err := r.Peek(1); err == nil && b[0] == '\n' {
+		_, _ = r.Discard(1)
+	}
+	cc := f(&bufferedConn{Reader: r, Conn: conn})
+	if lc, ok := cc.(code.Limited); ok {
+		lc.SetLimits(s.limits.Load())
+	}
+	if lc, ok := cc.(code.Logged); ok {
+		lc.SetLogger(logger)
+	}
+	if id != nil {
+		logger = irpc.With(logger, "subject", id.Subject)
+	}
+	logger.Debug("connection accepted")
+	s.serveCode(&verifyingCode{ICode: cc, s: s}, logger, &opt, id)
+}
+
+// 读取时先读json解码器缓冲的数据，再读连接
+type bufferedConn struct {
+	io.Reader
+	net.Conn
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+// 一个连接上正在处理的请求，收到取消消息时通过它取消请求的ctx，
+// 收到窗口更新时通过它找到对应的流
+type inflight struct {
+	mu      sync.Mutex
+	cancels map[uint64]context.CancelFunc
+	streams map[uint64]*serverStream
+}
+
+func (in *inflight) add(seq uint64, cancel context.CancelFunc) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.cancels[seq] = cancel
+}
+
+func (in *inflight) addStream(ss *serverStream) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	in.streams[ss.seq] = ss
 }
 
-func (s *Server) serveCode(code irpc.ICode) {
+func (in *inflight) stream(seq uint64) *serverStream {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	return in.streams[seq]
+}
+
+func (in *inflight) remove(seq uint64) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	delete(in.cancels, seq)
+	delete(in.streams, seq)
+}
+
+// 读循环结束后取消所有请求并结束所有流的接收，
+// 否则阻塞在Recv或者SendMsg中的流方法永远不会返回
+func (in *inflight) abort() {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	for _, cancel := range in.cancels {
+		cancel()
+	}
+	for _, ss := range in.streams {
+		ss.closeRecv()
+	}
+}
+
+// 取出seq对应请求的cancel函数，请求已经处理完时返回nil
+func (in *inflight) take(seq uint64) context.CancelFunc {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	cancel := in.cancels[seq]
+	delete(in.cancels, seq)
+	return cancel
+}
+
+func (s *Server) serveCode(code irpc.ICode, logger irpc.Logger, opt *Option, id *Identity) {
 	// Mutex make sure that serve return a complete response
 	mu := new(sync.Mutex)
 	wg := new(sync.WaitGroup)
+	running := &inflight{
+		cancels: make(map[uint64]context.CancelFunc),
+		streams: make(map[uint64]*serverStream),
+	}
+	var peer *Peer
+	if opt.Bidirectional {
+		peer = newPeer(code, mu)
+		peer.id = id
+		if fn := s.onPeer.Load(); fn != nil {
+			// 回调中可能调用客户端，不能阻塞读循环
+			go (*fn)(peer)
+		}
+	}
 	for {
-		req, err := s.readRequest(code)
+		req, err := s.readRequest(code, logger)
 		if err != nil {
 			if req == nil {
 				break
@@ -98,95 +302,352 @@ func (s *Server) serveCode(code irpc.ICode) {
 			// 如果读Header出错
 			// 给客户端返回一个头中包含错误信息的消息
 			req.h.Error = err.Error()
-			s.sendResponse(code, req.h, invalidRequest, mu)
+			req.h.Code = irpc.CodeOf(err)
+			s.metrics.Start(s.methodLabel(req.h.ServiceMethod))(req.h.Code)
+			s.sendResponse(code, logger, req.h, invalidRequest, mu)
+			continue
+		}
+		// 服务端发起的调用的响应
+		if req.h.Reverse {
+			if peer == nil {
+				err = code.ReadBody(nil)
+			} else {
+				err = peer.receive(code, req.h)
+			}
+			if err != nil {
+				break
+			}
+			continue
+		}
+		if req.h.Kind == irpc.KindCancel {
+			if cancel := running.take(req.h.Seq); cancel != nil {
+				atomic.AddUint64(&s.stats.canceled, 1)
+				cancel()
+			}
+			continue
+		}
+		if req.h.Kind == irpc.KindPing {
+			s.sendResponse(code, logger, &irpc.Header{Seq: req.h.Seq, Kind: irpc.KindPong}, invalidRequest, mu)
+			continue
+		}
+		if req.h.Kind == irpc.KindWindowUpdate {
+			if ss := running.stream(req.h.Seq); ss != nil {
+				ss.grant(req.h.Window)
+			}
+			continue
+		}
+		// 客户端流中的消息
+		if req.h.Kind == irpc.KindStreamMsg || req.h.Kind == irpc.KindStreamEnd {
+			if err := s.readStreamMsg(code, logger, req.h, running); err != nil {
+				break
+			}
+			continue
+		}
+		if req.batch != nil {
+			atomic.AddUint64(&s.stats.requests, uint64(len(req.batch.Calls)))
+		} else {
+			atomic.AddUint64(&s.stats.requests, 1)
+		}
+		if req.batch == nil {
+			if err := s.authorize(id, req.h.ServiceMethod); err != nil {
+				atomic.AddUint64(&s.stats.errors, 1)
+				if req.argp != nil {
+					req.mType.Free(req.argp, req.replyp)
+				}
+				req.h.Error = err.Error()
+				req.h.Code = irpc.CodeOf(err)
+				s.metrics.Start(req.h.ServiceMethod)(req.h.Code)
+				s.sendResponse(code, logger, req.h, invalidRequest, mu)
+				continue
+			}
+		}
+		if req.h.OneWay && req.mType != nil && req.mType.Streaming != service.Unary {
+			logger.Warn("streaming method can't be called one-way", "method", req.h.ServiceMethod, "seq", req.h.Seq)
 			continue
 		}
+		// 处理时间取服务端配置和客户端剩余时间中较小的一个
+		timeout := opt.HandleTimeout
+		if req.h.Timeout > 0 && (timeout == 0 || req.h.Timeout < timeout) {
+			timeout = req.h.Timeout
+		}
+		base := context.Background()
+		if id != nil {
+			base = context.WithValue(base, identityKey{}, id)
+		}
+		if peer != nil {
+			base = context.WithValue(base, peerKey{}, peer)
+		}
+		ctx, cancel := context.WithCancel(base)
+		if timeout > 0 {
+			ctx, cancel = context.WithTimeout(base, timeout)
+		}
+		running.add(req.h.Seq, cancel)
+		if req.batch == nil && req.mType.Streaming != service.Unary {
+			req.stream = newServerStream(ctx, code, mu, req.h, req.mType)
+			running.addStream(req.stream)
+		}
 		wg.Add(1)
-		go s.handleRequest(code, req, mu, wg, time.Second*5)
+		go func(req *request) {
+			defer running.remove(req.h.Seq)
+			defer cancel()
+			if req.batch != nil {
+				s.handleBatch(ctx, code, logger, req, mu, wg, timeout)
+				return
+			}
+			s.handleRequest(ctx, code, logger, req, mu, wg, timeout)
+		}(req)
+	}
+	// 读循环结束后不会再收到响应，先结束等待客户端的调用，避免处理中的请求一直阻塞
+	if peer != nil {
+		peer.terminate()
 	}
+	running.abort()
 	wg.Wait()
 	code.Close()
 }
 
-func (s *Server) readRequest(code irpc.ICode) (*request, error) {
-	h, err := s.readRequestHeader(code)
+func (s *Server) readRequest(code irpc.ICode, logger irpc.Logger) (*request, error) {
+	h, err := s.readRequestHeader(code, logger)
 	if err != nil {
-		return nil, err
+		// 签名校验失败时body已经读完，只拒绝这个请求，
+		// 流中的消息和控制消息被篡改时无法继续，关闭连接
+		if h == nil || h.Reverse || (h.Kind != irpc.KindCall && h.Kind != irpc.KindBatch) {
+			return nil, err
+		}
+		h.Sign = nil
+		return &request{h: h}, err
 	}
 	req := &request{
 		h: h,
 	}
+	// 服务端发起的调用的响应由Peer读取body
+	if h.Reverse {
+		return req, nil
+	}
+	// 控制消息没有有用的body
+	if h.Kind == irpc.KindCancel || h.Kind == irpc.KindWindowUpdate || h.Kind == irpc.KindPing {
+		if err := code.ReadBody(nil); err != nil {
+			return nil, err
+		}
+		return req, nil
+	}
+	// 流消息的body由readStreamMsg读取
+	if h.Kind == irpc.KindStreamMsg || h.Kind == irpc.KindStreamEnd {
+		return req, nil
+	}
+	if h.Kind == irpc.KindBatch {
+		req.batch = new(irpc.BatchRequest)
+		if err := code.ReadBody(req.batch); err != nil {
+			req.batch = nil
+			return bodyError(req, err)
+		}
+		return req, nil
+	}
 
 	req.svc, req.mType, err = s.findService(h.ServiceMethod)
 	if err != nil {
-		return nil, err
+		// 丢弃body，保证下一次读到的是下一个请求的header
+		_ = code.ReadBody(nil)
+		return req, err
+	}
+	// 客户端流和双向流方法的请求没有参数，参数通过流发送
+	if req.mType.Streaming == service.ClientStreaming || req.mType.Streaming == service.BidiStreaming {
+		if req.mType.Streaming == service.ClientStreaming {
+			req.reply = req.mType.NewReply()
+		}
+		if err := code.ReadBody(nil); err != nil {
+			return bodyError(req, err)
+		}
+		return req, nil
+	}
+	if req.mType.Fast() {
+		req.argp, req.replyp = req.mType.NewArgs()
+		if err := code.ReadBody(req.argp); err != nil {
+			logger.Warn("read argv failed", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+			req.mType.Free(req.argp, req.replyp)
+			req.argp, req.replyp = nil, nil
+			return bodyError(req, err)
+		}
+		return req, nil
 	}
 	//req.argv = reflect.New(reflect.TypeOf(" "))
 	req.argv = req.mType.NewArgv()
-	req.reply = req.mType.NewReply()
+	if req.mType.Streaming == service.Unary {
+		req.reply = req.mType.NewReply()
+	}
 
 	argvi := req.argv.Interface()
 	if req.argv.Type().Kind() != reflect.Ptr {
 		argvi = req.argv.Addr().Interface()
 	}
 	if err := code.ReadBody(argvi); err != nil {
-		log.Println("[rpc server]: read argv faild:", err)
-		return nil, err
+		logger.Warn("read argv failed", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+		return bodyError(req, err)
 	}
 	return req, nil
 }
 
-func (s *Server) sendResponse(code irpc.ICode, h *irpc.Header, body interface{}, sending *sync.Mutex) {
+// 请求的body过大但已经被跳过时只拒绝这个请求，其它读错误关闭连接
+func bodyError(req *request, err error) (*request, error) {
+	if rerr := rejectTooLarge(err); rerr != nil {
+		return req, rerr
+	}
+	return nil, err
+}
+
+// err是已经被跳过的过大的消息时返回给客户端的错误，否则返回nil
+func rejectTooLarge(err error) error {
+	var tooLarge *code.TooLargeError
+	if errors.As(err, &tooLarge) && !tooLarge.Fatal {
+		return irpc.NewError(irpc.CodeResourceExhausted, "[rpc server] request "+tooLarge.Error())
+	}
+	return nil
+}
+
+// 读取客户端流中的消息或者客户端关闭发送的通知
+func (s *Server) readStreamMsg(code irpc.ICode, logger irpc.Logger, h *irpc.Header, running *inflight) error {
+	ss := running.stream(h.Seq)
+	if ss == nil {
+		// 流已经结束
+		return code.ReadBody(nil)
+	}
+	if h.Kind == irpc.KindStreamEnd {
+		ss.closeRecv()
+		return code.ReadBody(nil)
+	}
+	ok, err := ss.readMsg(code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		// 客户端没有遵守流控，结束这个流
+		if cancel := running.take(h.Seq); cancel != nil {
+			cancel()
+		}
+		s.sendResponse(code, logger, &irpc.Header{
+			ServiceMethod: h.ServiceMethod,
+			Seq:           h.Seq,
+			Kind:          irpc.KindStreamEnd,
+			Error:         "[rpc server] stream window exceeded",
+			Code:          irpc.CodeResourceExhausted,
+		}, invalidRequest, ss.sending)
+	}
+	return nil
+}
+
+func (s *Server) sendResponse(code irpc.ICode, logger irpc.Logger, h *irpc.Header, body interface{}, sending *sync.Mutex) {
+	// 单向调用不返回任何响应，包括错误
+	if h.OneWay {
+		return
+	}
+	// 编码器的状态不能并发使用，header和body也必须连续写出，所以仍然需要加锁；
+	// 合并写时Write只把消息编码进缓冲区，不等待写连接，持有锁的时间很短
 	sending.Lock()
 	defer sending.Unlock()
 	if err := code.Write(h, body); err != nil {
-		log.Println("[rpc server]: write response err:", err)
+		logger.Error("write response failed", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
 	}
 }
-func (s *Server) handleRequest(code irpc.ICode, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
+
+// ctx在超时或者客户端取消请求时结束，方法的第一个参数是context.Context时会传给方法
+// 服务端流方法的结果用KindStreamEnd消息返回
+func (s *Server) handleRequest(ctx context.Context, code irpc.ICode, logger irpc.Logger, req *request, sending *sync.Mutex, wg *sync.WaitGroup, timeout time.Duration) {
 	defer wg.Done()
-	called := make(chan struct{})
-	sent := make(chan struct{})
+	finish := s.metrics.Start(req.h.ServiceMethod)
+	// 响应头中的错误码就是请求的结果
+	defer func() { finish(req.h.Code) }()
+	called := make(chan error, 1)
 	go func() {
-		err := req.svc.Call(req.mType, req.argv, req.reply)
-		called <- struct{}{}
-		if err != nil {
-			req.h.Error = err.Error()
-			s.sendResponse(code, req.h, invalidRequest, sending)
-			sent <- struct{}{}
+		if req.stream != nil {
+			called <- req.svc.CallStream(ctx, req.mType, req.argv, req.reply, req.stream)
+			return
+		}
+		if req.argp != nil {
+			called <- req.svc.CallFast(ctx, req.mType, req.argp, req.replyp)
 			return
 		}
-		s.sendResponse(code, req.h, req.reply.Interface(), sending)
-		sent <- struct{}{}
+		called <- req.svc.CallContext(ctx, req.mType, req.argv, req.reply)
 	}()
-	if timeout == 0 {
-		<-called
-		<-sent
-		return
+	if req.stream != nil {
+		req.h.Kind = irpc.KindStreamEnd
 	}
 	select {
-	case <-time.After(timeout):
+	case <-ctx.Done():
+		if ctx.Err() == context.Canceled {
+			// 客户端已经放弃了这个请求，不需要返回结果
+			req.h.Code = irpc.CodeCanceled
+			return
+		}
+		atomic.AddUint64(&s.stats.timeouts, 1)
 		req.h.Error = fmt.Sprintf("[rpc server] request handle timeout:expect within %s", timeout)
-		s.sendResponse(code, req.h, invalidRequest, sending)
-	case <-called:
-		<-sent
+		req.h.Code = irpc.CodeDeadlineExceeded
+		s.sendResponse(code, logger, req.h, invalidRequest, sending)
+	case err := <-called:
+		// 方法已经返回，响应写出后参数和reply可以复用，超时的请求不放回
+		if req.argp != nil {
+			defer req.mType.Free(req.argp, req.replyp)
+		}
+		if err != nil {
+			atomic.AddUint64(&s.stats.errors, 1)
+			req.h.Error = err.Error()
+			req.h.Code = irpc.CodeOf(err)
+			s.sendResponse(code, logger, req.h, invalidRequest, sending)
+			return
+		}
+		if req.stream != nil {
+			// 客户端流方法的reply作为流中的最后一条消息返回
+			if req.mType.Streaming == service.ClientStreaming {
+				if err := req.stream.SendMsg(req.reply.Interface()); err != nil {
+					req.h.Code = irpc.CodeOf(err)
+					return
+				}
+			}
+			s.sendResponse(code, logger, req.h, invalidRequest, sending)
+			return
+		}
+		if req.argp != nil {
+			s.sendResponse(code, logger, req.h, req.replyp, sending)
+			return
+		}
+		s.sendResponse(code, logger, req.h, req.reply.Interface(), sending)
 	}
 }
-func (s *Server) readRequestHeader(iCode irpc.ICode) (*irpc.Header, error) {
+func (s *Server) readRequestHeader(iCode irpc.ICode, logger irpc.Logger) (*irpc.Header, error) {
 	var h irpc.Header
 	if err := iCode.ReadHeader(&h); err != nil {
 		if err != io.EOF && err != io.ErrUnexpectedEOF {
-			log.Println("[rpc server]: read header error:", err)
+			logger.Warn("read header failed", "method", h.ServiceMethod, "seq", h.Seq, "err", err)
+		}
+		// 带错误码的错误是消息被拒绝，header是完整的
+		var e *irpc.Error
+		if errors.As(err, &e) {
+			return &h, err
 		}
 		return nil, err
 	}
 	return &h, nil
 }
 
+// rcvr的类型名不是公开的名字时返回错误
 func (s *Server) Register(rcvr interface{}) error {
-	service := service.NewService(rcvr)
-	if _, dup := s.serviceMap.LoadOrStore(service.Name, service); dup {
-		return errors.New("[rpc server] service already defined:" + service.Name)
+	svc, err := service.NewService(rcvr)
+	if err != nil {
+		return err
+	}
+	return s.register(svc)
+}
+
+// 使用指定的服务名注册
+func (s *Server) RegisterName(name string, rcvr interface{}) error {
+	return s.register(service.NewServiceName(name, rcvr))
+}
+
+func (s *Server) register(svc *service.Service) error {
+	if _, dup := s.serviceMap.LoadOrStore(svc.Name, svc); dup {
+		return errors.New("[rpc server] service already defined:" + svc.Name)
+	}
+	for name := range svc.Method {
+		s.log().Debug("register method", "component", "server", "service", svc.Name, "method", name)
 	}
 	return nil
 }
@@ -198,15 +659,19 @@ func Register(rcvr interface{}) error {
 func (s *Server) findService(serviceMethod string) (sev *service.Service, mType *service.MethodType, err error) {
 	dot := strings.LastIndex(serviceMethod, ".")
 	if dot < 0 {
-		err = errors.New("[rpc server] serviceMethod 格式错误" + serviceMethod)
+		err = irpc.NewError(irpc.CodeInvalidArgument, "[rpc server] serviceMethod 格式错误"+serviceMethod)
 		return
 	}
 	serviceName, methodName := serviceMethod[:dot], serviceMethod[dot+1:]
 	svc, ok := s.serviceMap.Load(serviceName)
 	if !ok {
-		err = errors.New("[rpc server] can't find service" + serviceName)
+		err = irpc.NewError(irpc.CodeNotFound, "[rpc server] can't find service"+serviceName)
+		return
 	}
 	sev = svc.(*service.Service)
 	mType = sev.Method[methodName]
+	if mType == nil {
+		err = irpc.NewError(irpc.CodeNotFound, "[rpc server] can't find method"+methodName)
+	}
 	return
 }
@@ -0,0 +1,137 @@
+package diyrpc
+
+import (
+	"crypto/hmac"
+	"sync"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 服务端校验请求签名的配置，用于在TLS终止于代理之后的链路上保证消息完整性
+type Signing struct {
+	// 密钥ID到密钥的映射，轮换时先加入新密钥，客户端都换成新密钥后再删除旧密钥
+	Keys map[string][]byte
+	// 消息的签名时间和服务端时间允许的最大差值，默认30秒
+	MaxSkew time.Duration
+}
+
+const defaultMaxSkew = 30 * time.Second
+
+// 设置后连接上收到的每条消息都必须带有效的签名，被篡改、过期或者重放的请求返回CodeUnauthenticated
+// 可以在运行时替换，对已经建立的连接立即生效，为空时不要求签名
+func (s *Server) SetSigning(cfg *Signing) {
+	s.signing.Store(cfg)
+}
+
+func (cfg *Signing) maxSkew() time.Duration {
+	if cfg.MaxSkew > 0 {
+		return cfg.MaxSkew
+	}
+	return defaultMaxSkew
+}
+
+// 校验读到的消息的签名
+// 签名消息的body在ReadHeader中就读出来，校验失败时body已经被读完，
+// 返回带错误码的错误，连接上后面的消息不受影响
+type verifyingCode struct {
+	irpc.ICode
+	s *Server
+	// 签名消息编码后的body
+	raw    []byte
+	signed bool
+}
+
+func (vc *verifyingCode) ReadHeader(h *irpc.Header) error {
+	vc.raw, vc.signed = nil, false
+	if err := vc.ICode.ReadHeader(h); err != nil {
+		return err
+	}
+	cfg := vc.s.signing.Load()
+	if h.Sign == nil {
+		if cfg == nil {
+			return nil
+		}
+		if err := vc.ICode.ReadBody(nil); err != nil {
+			return err
+		}
+		vc.signed = true
+		return irpc.NewError(irpc.CodeUnauthenticated, "[rpc server] message is not signed")
+	}
+	if err := vc.ICode.ReadBody(&vc.raw); err != nil {
+		// body过大但已经被跳过时只拒绝这条消息
+		if rerr := rejectTooLarge(err); rerr != nil {
+			vc.raw, vc.signed = nil, true
+			return rerr
+		}
+		return err
+	}
+	vc.signed = true
+	if cfg == nil {
+		return nil
+	}
+	return vc.s.verify(cfg, h, vc.raw)
+}
+
+func (vc *verifyingCode) ReadBody(body interface{}) error {
+	if !vc.signed {
+		return vc.ICode.ReadBody(body)
+	}
+	if body == nil || len(vc.raw) == 0 {
+		return nil
+	}
+	return vc.ICode.DecodeValue(vc.raw, body)
+}
+
+func (s *Server) verify(cfg *Signing, h *irpc.Header, raw []byte) error {
+	sign := h.Sign
+	key, ok := cfg.Keys[sign.KeyID]
+	if !ok {
+		return irpc.NewError(irpc.CodeUnauthenticated, "[rpc server] unknown signing key "+sign.KeyID)
+	}
+	skew := time.Since(time.Unix(0, sign.Timestamp))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > cfg.maxSkew() {
+		return irpc.Errorf(irpc.CodeUnauthenticated, "[rpc server] stale message: signed %s away from server time", skew)
+	}
+	if !hmac.Equal(sign.MAC, irpc.SignMAC(key, h, raw)) {
+		return irpc.NewError(irpc.CodeUnauthenticated, "[rpc server] invalid message signature")
+	}
+	// 签名正确后才记录nonce，伪造的消息不会占用缓存
+	if !s.nonces.add(sign.KeyID, sign.Nonce, cfg.maxSkew()) {
+		return irpc.NewError(irpc.CodeUnauthenticated, "[rpc server] replayed message")
+	}
+	return nil
+}
+
+// 最近用过的nonce，超过允许的时间差的消息本身就会被拒绝，所以nonce只需要保存两倍的时间差
+type nonceCache struct {
+	mu     sync.Mutex
+	seen   map[string]time.Time
+	pruned time.Time
+}
+
+// 返回false表示nonce已经用过
+func (c *nonceCache) add(keyID string, nonce []byte, skew time.Duration) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if c.seen == nil {
+		c.seen = make(map[string]time.Time)
+	}
+	if now.Sub(c.pruned) > skew {
+		for k, expire := range c.seen {
+			if now.After(expire) {
+				delete(c.seen, k)
+			}
+		}
+		c.pruned = now
+	}
+	k := keyID + "\x00" + string(nonce)
+	if expire, ok := c.seen[k]; ok && now.Before(expire) {
+		return false
+	}
+	c.seen[k] = now.Add(2 * skew)
+	return true
+}
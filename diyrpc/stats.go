@@ -0,0 +1,47 @@
+package diyrpc
+
+import (
+	"sync/atomic"
+	"tinyRPCFramwork/metrics"
+)
+
+// 服务端的统计信息
+type Stats struct {
+	// 收到的请求数，不包括取消消息
+	Requests uint64
+	// 处理过程中被客户端取消的请求数
+	Canceled uint64
+	// 处理超时的请求数
+	Timeouts uint64
+	// 方法返回错误的请求数
+	Errors uint64
+}
+
+type serverStats struct {
+	requests uint64
+	canceled uint64
+	timeouts uint64
+	errors   uint64
+}
+
+func (s *Server) Stats() Stats {
+	return Stats{
+		Requests: atomic.LoadUint64(&s.stats.requests),
+		Canceled: atomic.LoadUint64(&s.stats.canceled),
+		Timeouts: atomic.LoadUint64(&s.stats.timeouts),
+		Errors:   atomic.LoadUint64(&s.stats.errors),
+	}
+}
+
+// 设置记录指标的RPCMetrics，见metrics.NewServerMetrics，需要在处理连接之前设置
+func (s *Server) SetMetrics(m *metrics.RPCMetrics) {
+	s.metrics = m
+}
+
+// 指标中的方法名，找不到的方法统一记为unknown，避免客户端发送任意的方法名产生大量序列
+func (s *Server) methodLabel(serviceMethod string) string {
+	if _, _, err := s.findService(serviceMethod); err != nil {
+		return "unknown"
+	}
+	return serviceMethod
+}
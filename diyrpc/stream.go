@@ -0,0 +1,159 @@
+package diyrpc
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"sync"
+	"tinyRPCFramwork/irpc"
+	"tinyRPCFramwork/service"
+)
+
+// 流控窗口，即不等确认最多能发出的消息数
+// 服务端发送时使用请求中的Window，请求中没有指定时使用这个值，
+// 客户端发送时总是使用这个值
+const DefaultStreamWindow = 16
+
+// 服务端的流
+// 每发送一条消息消耗一个窗口，窗口用完时阻塞，直到对方发来KindWindowUpdate，
+// 避免慢的一方让另一方堆积消息，也避免一个流占满连接的读协程而影响其他流
+type serverStream struct {
+	ctx     context.Context
+	code    irpc.ICode
+	sending *sync.Mutex
+	seq     uint64
+	method  string
+
+	mu      sync.Mutex
+	credits uint32
+	// 窗口增加时关闭并替换，唤醒等待窗口的Send
+	granted chan struct{}
+
+	// 客户端发来的消息，容量等于窗口大小
+	msgType reflect.Type
+	in      chan interface{}
+	// 客户端关闭发送后关闭
+	halfClosed chan struct{}
+	closeOnce  sync.Once
+	// 已经被Recv取走、还没有告诉客户端的消息数
+	consumed uint32
+}
+
+var _ service.StreamConn = (*serverStream)(nil)
+
+func newServerStream(ctx context.Context, code irpc.ICode, sending *sync.Mutex, h *irpc.Header, mType *service.MethodType) *serverStream {
+	window := h.Window
+	if window == 0 {
+		window = DefaultStreamWindow
+	}
+	ss := &serverStream{
+		ctx:        ctx,
+		code:       code,
+		sending:    sending,
+		seq:        h.Seq,
+		method:     h.ServiceMethod,
+		credits:    window,
+		granted:    make(chan struct{}),
+		halfClosed: make(chan struct{}),
+	}
+	if mType.Streaming == service.ClientStreaming || mType.Streaming == service.BidiStreaming {
+		ss.msgType = mType.ArgType
+		ss.in = make(chan interface{}, DefaultStreamWindow)
+	}
+	return ss
+}
+
+func (ss *serverStream) Context() context.Context {
+	return ss.ctx
+}
+
+func (ss *serverStream) SendMsg(msg interface{}) error {
+	for {
+		ss.mu.Lock()
+		if ss.credits > 0 {
+			ss.credits--
+			ss.mu.Unlock()
+			break
+		}
+		granted := ss.granted
+		ss.mu.Unlock()
+		select {
+		case <-ss.ctx.Done():
+			return ss.ctx.Err()
+		case <-granted:
+		}
+	}
+	if err := ss.ctx.Err(); err != nil {
+		return err
+	}
+	return ss.write(&irpc.Header{ServiceMethod: ss.method, Seq: ss.seq, Kind: irpc.KindStreamMsg}, msg)
+}
+
+func (ss *serverStream) write(h *irpc.Header, body interface{}) error {
+	ss.sending.Lock()
+	defer ss.sending.Unlock()
+	return ss.code.Write(h, body)
+}
+
+func (ss *serverStream) RecvMsg() (interface{}, error) {
+	if ss.in == nil {
+		return nil, io.EOF
+	}
+	var msg interface{}
+	select {
+	case msg = <-ss.in:
+	case <-ss.ctx.Done():
+		return nil, ss.ctx.Err()
+	case <-ss.halfClosed:
+		// 关闭前收到的消息要先交给方法
+		select {
+		case msg = <-ss.in:
+		default:
+			return nil, io.EOF
+		}
+	}
+	ss.mu.Lock()
+	ss.consumed++
+	var n uint32
+	if ss.consumed >= DefaultStreamWindow/2 {
+		n, ss.consumed = ss.consumed, 0
+	}
+	ss.mu.Unlock()
+	if n > 0 {
+		_ = ss.write(&irpc.Header{Seq: ss.seq, Kind: irpc.KindWindowUpdate, Window: n}, invalidRequest)
+	}
+	return msg, nil
+}
+
+// 对方确认了n条消息
+func (ss *serverStream) grant(n uint32) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	ss.credits += n
+	close(ss.granted)
+	ss.granted = make(chan struct{})
+}
+
+// 读取客户端发来的一条消息，客户端超出窗口时返回false
+func (ss *serverStream) readMsg(code irpc.ICode) (bool, error) {
+	if ss.in == nil {
+		return true, code.ReadBody(nil)
+	}
+	msg := reflect.New(ss.msgType).Interface()
+	if err := code.ReadBody(msg); err != nil {
+		return true, err
+	}
+	select {
+	case ss.in <- msg:
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// 客户端关闭了发送
+func (ss *serverStream) closeRecv() {
+	ss.closeOnce.Do(func() {
+		close(ss.halfClosed)
+	})
+}
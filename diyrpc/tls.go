@@ -0,0 +1,36 @@
+package diyrpc
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net"
+)
+
+// 设置后Accept和ServeConn收到的连接都先进行TLS握手，为空时使用明文连接
+// cfg.ClientAuth为tls.RequireAndVerifyClientCert时就是双向TLS，
+// 客户端证书的Subject.CommonName作为连接的身份
+func (s *Server) SetTLSConfig(cfg *tls.Config) {
+	s.tlsConfig.Store(cfg)
+}
+
+// 完成TLS握手，返回客户端证书，客户端没有提供证书时返回nil
+// 传入的连接已经是TLS连接时直接使用，否则在设置了TLS配置时包装*conn
+func (s *Server) handshakeTLS(conn *net.Conn) (*x509.Certificate, error) {
+	tc, ok := (*conn).(*tls.Conn)
+	if !ok {
+		cfg := s.tlsConfig.Load()
+		if cfg == nil {
+			return nil, nil
+		}
+		tc = tls.Server(*conn, cfg)
+		*conn = tc
+	}
+	// 握手超时由ServeConn设置的连接超时限制
+	if err := tc.Handshake(); err != nil {
+		return nil, err
+	}
+	if certs := tc.ConnectionState().PeerCertificates; len(certs) > 0 {
+		return certs[0], nil
+	}
+	return nil, nil
+}
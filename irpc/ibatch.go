@@ -0,0 +1,27 @@
+package irpc
+
+// 批量调用中的一个请求
+// 各个请求的参数类型不同，参数用连接的ICode.EncodeValue单独编码，服务端按方法的参数类型解码
+type BatchCall struct {
+	ServiceMethod string
+	Args          []byte
+}
+
+// KindBatch请求的body
+type BatchRequest struct {
+	Calls []BatchCall
+	// 按顺序依次执行，否则并发执行
+	Ordered bool
+}
+
+// 批量调用中一个请求的结果，Error为空时Reply有效
+type BatchResult struct {
+	Error string
+	Code  Code
+	Reply []byte
+}
+
+// KindBatch响应的body，Results和请求中的Calls一一对应
+type BatchResponse struct {
+	Results []BatchResult
+}
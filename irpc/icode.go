@@ -2,6 +2,28 @@ package irpc
 
 import (
 	"io"
+	"time"
+)
+
+// 消息类型
+type Kind uint8
+
+const (
+	// 普通的请求或响应
+	KindCall Kind = iota
+	// 客户端放弃了Seq对应的请求，服务端不需要再返回结果
+	KindCancel
+	// 流中的一条消息
+	KindStreamMsg
+	// 流结束，Error不为空时表示流出错
+	KindStreamEnd
+	// 接收方处理完了Window条消息，发送方可以继续发送
+	KindWindowUpdate
+	// 批量调用，body是BatchRequest，响应的body是BatchResponse
+	KindBatch
+	// 心跳，客户端在连接空闲时发送，服务端回复KindPong
+	KindPing
+	KindPong
 )
 
 // message header
@@ -12,6 +34,19 @@ type Header struct {
 	Seq uint64
 	// 返回的错误信息
 	Error string
+	// 错误码，Error不为空时有效
+	Code Code
+	// 客户端剩余的超时时间，服务端用它限制处理时间，0表示没有限制
+	Timeout time.Duration
+	Kind    Kind
+	// 流控窗口，请求中表示初始窗口，KindWindowUpdate中表示窗口增量
+	Window uint32
+	// 双向连接中由服务端发起、客户端处理的调用，请求和响应都带这个标记
+	Reverse bool
+	// 单向调用，服务端执行方法但不返回响应
+	OneWay bool
+	// 请求签名，为空表示没有签名
+	Sign *Signature
 }
 
 type ICode interface {
@@ -19,6 +54,10 @@ type ICode interface {
 	ReadHeader(header *Header) error
 	ReadBody(interface{}) error
 	Write(*Header, interface{}) error
+	// 把单个值编码成可以单独解码的[]byte，和连接上的消息使用同一种格式，
+	// 批量调用的参数和返回值、签名消息的body用它编码
+	EncodeValue(v interface{}) ([]byte, error)
+	DecodeValue(data []byte, v interface{}) error
 }
 type NewCodeFunc func(closer io.ReadWriteCloser) ICode
 type Type string
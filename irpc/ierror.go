@@ -0,0 +1,95 @@
+package irpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 错误码，服务端通过Header.Code告诉客户端错误的类别
+// 客户端据此判断是否可以重试
+type Code uint32
+
+const (
+	CodeOK Code = iota
+	CodeCanceled
+	CodeUnknown
+	CodeInvalidArgument
+	CodeDeadlineExceeded
+	CodeNotFound
+	CodePermissionDenied
+	CodeResourceExhausted
+	CodeUnavailable
+	CodeUnauthenticated
+	CodeInternal
+)
+
+var codeNames = map[Code]string{
+	CodeOK:                "OK",
+	CodeCanceled:          "Canceled",
+	CodeUnknown:           "Unknown",
+	CodeInvalidArgument:   "InvalidArgument",
+	CodeDeadlineExceeded:  "DeadlineExceeded",
+	CodeNotFound:          "NotFound",
+	CodePermissionDenied:  "PermissionDenied",
+	CodeResourceExhausted: "ResourceExhausted",
+	CodeUnavailable:       "Unavailable",
+	CodeUnauthenticated:   "Unauthenticated",
+	CodeInternal:          "Internal",
+}
+
+func (c Code) String() string {
+	if name, ok := codeNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Code(%d)", uint32(c))
+}
+
+// 带错误码的错误
+type Error struct {
+	Code Code
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	return e.Msg
+}
+
+func NewError(code Code, msg string) error {
+	return &Error{Code: code, Msg: msg}
+}
+
+func Errorf(code Code, format string, a ...interface{}) error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, a...)}
+}
+
+// 取出err的错误码，不带错误码的错误视为CodeUnknown
+func CodeOf(err error) Code {
+	if err == nil {
+		return CodeOK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return CodeUnknown
+}
+
+// 把对端在header中返回的错误转换成带错误码的错误，没有错误码的视为CodeUnknown
+func HeaderError(h *Header) error {
+	code := h.Code
+	if code == CodeOK {
+		code = CodeUnknown
+	}
+	return NewError(code, h.Error)
+}
+
+// ctx结束后调用失败的错误，超时是CodeDeadlineExceeded，否则是CodeCanceled，
+// prefix标明是哪一方的调用
+func ContextError(ctx context.Context, prefix string) error {
+	code := CodeCanceled
+	if ctx.Err() == context.DeadlineExceeded {
+		code = CodeDeadlineExceeded
+	}
+	return NewError(code, prefix+":"+ctx.Err().Error())
+}
@@ -0,0 +1,142 @@
+package irpc
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+)
+
+// 分级的结构化日志，args是交替的键和值，和log/slog的用法相同，
+// *slog.Logger可以直接作为Logger使用
+// 框架只通过Logger输出日志，不会因为出错退出进程
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// 日志级别
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+var levelNames = [...]string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// 通过标准库log输出的Logger，格式为"INFO msg key=value ..."
+// 开启log.Lshortfile或log.Llongfile时记录的是irpc包外第一个调用方的位置，经过With包装也一样
+type StdLogger struct {
+	// 为空时使用log.Default()
+	Logger *log.Logger
+	// 低于这个级别的日志被丢弃
+	Level Level
+}
+
+func (l *StdLogger) Debug(msg string, args ...interface{}) { l.log(LevelDebug, msg, args) }
+func (l *StdLogger) Info(msg string, args ...interface{})  { l.log(LevelInfo, msg, args) }
+func (l *StdLogger) Warn(msg string, args ...interface{})  { l.log(LevelWarn, msg, args) }
+func (l *StdLogger) Error(msg string, args ...interface{}) { l.log(LevelError, msg, args) }
+
+func (l *StdLogger) log(level Level, msg string, args []interface{}) {
+	if level < l.Level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for i := 0; i < len(args); i += 2 {
+		if i+1 < len(args) {
+			fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		} else {
+			// 落单的值没有键
+			fmt.Fprintf(&b, " !BADKEY=%v", args[i])
+		}
+	}
+	out := l.Logger
+	if out == nil {
+		out = log.Default()
+	}
+	_ = out.Output(callerDepth(), b.String())
+}
+
+// 本包函数名的前缀，如"tinyRPCFramwork/irpc."
+var pkgPrefix = func() string {
+	pc, _, _, _ := runtime.Caller(0)
+	name := runtime.FuncForPC(pc).Name()
+	slash := strings.LastIndex(name, "/")
+	return name[:slash+1+strings.Index(name[slash+1:], ".")+1]
+}()
+
+// 传给log.Logger.Output的calldepth，跳过本包中的Logger和With包装，指向包外第一个调用方
+func callerDepth() int {
+	var pcs [16]uintptr
+	// 从StdLogger.log开始，它的calldepth是1
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	depth := 1
+	for {
+		f, more := frames.Next()
+		if !strings.HasPrefix(f.Function, pkgPrefix) || !more {
+			return depth
+		}
+		depth++
+	}
+}
+
+// 丢弃所有日志
+type NopLogger struct{}
+
+func (NopLogger) Debug(string, ...interface{}) {}
+func (NopLogger) Info(string, ...interface{})  {}
+func (NopLogger) Warn(string, ...interface{})  {}
+func (NopLogger) Error(string, ...interface{}) {}
+
+// 没有设置Logger时使用
+var DefaultLogger Logger = &StdLogger{Level: LevelInfo}
+
+// 返回的Logger在每条日志前加上args，用于带上连接地址等公共字段
+func With(l Logger, args ...interface{}) Logger {
+	if len(args) == 0 {
+		return l
+	}
+	if w, ok := l.(*withLogger); ok {
+		return &withLogger{l: w.l, args: append(append([]interface{}{}, w.args...), args...)}
+	}
+	return &withLogger{l: l, args: args}
+}
+
+type withLogger struct {
+	l    Logger
+	args []interface{}
+}
+
+func (w *withLogger) Debug(msg string, args ...interface{}) { w.l.Debug(msg, w.join(args)...) }
+func (w *withLogger) Info(msg string, args ...interface{})  { w.l.Info(msg, w.join(args)...) }
+func (w *withLogger) Warn(msg string, args ...interface{})  { w.l.Warn(msg, w.join(args)...) }
+func (w *withLogger) Error(msg string, args ...interface{}) { w.l.Error(msg, w.join(args)...) }
+
+func (w *withLogger) join(args []interface{}) []interface{} {
+	return append(append(make([]interface{}, 0, len(w.args)+len(args)), w.args...), args...)
+}
+
+// 返回l，l为空时返回DefaultLogger
+func LoggerOr(l Logger) Logger {
+	if l == nil {
+		return DefaultLogger
+	}
+	return l
+}
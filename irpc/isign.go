@@ -0,0 +1,62 @@
+package irpc
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"hash"
+)
+
+// 请求签名，Header.Sign不为空时body是ICode.EncodeValue编码后的[]byte，
+// 接收方先校验签名再解码
+type Signature struct {
+	// 签名使用的密钥ID，轮换密钥时新旧密钥可以同时有效
+	KeyID string
+	// 签名时间，unix纳秒，超出允许的时间差的消息被拒绝
+	Timestamp int64
+	// 随机数，同一个密钥的nonce在有效期内只能使用一次
+	Nonce []byte
+	// HMAC-SHA256(header+body)
+	MAC []byte
+}
+
+// 计算h和body的MAC，h.Sign中除MAC以外的字段都参与计算
+func SignMAC(secret []byte, h *Header, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	writeString(mac, h.ServiceMethod)
+	writeUint(mac, h.Seq)
+	writeString(mac, h.Error)
+	writeUint(mac, uint64(h.Code))
+	writeUint(mac, uint64(h.Timeout))
+	writeUint(mac, uint64(h.Kind))
+	writeUint(mac, uint64(h.Window))
+	writeBool(mac, h.Reverse)
+	writeBool(mac, h.OneWay)
+	if h.Sign != nil {
+		writeString(mac, h.Sign.KeyID)
+		writeUint(mac, uint64(h.Sign.Timestamp))
+		writeString(mac, string(h.Sign.Nonce))
+	}
+	writeString(mac, string(body))
+	return mac.Sum(nil)
+}
+
+// 变长字段前写长度，避免不同字段的拼接结果相同
+func writeString(h hash.Hash, s string) {
+	writeUint(h, uint64(len(s)))
+	h.Write([]byte(s))
+}
+
+func writeUint(h hash.Hash, v uint64) {
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], v)
+	h.Write(b[:])
+}
+
+func writeBool(h hash.Hash, v bool) {
+	if v {
+		h.Write([]byte{1})
+	} else {
+		h.Write([]byte{0})
+	}
+}
@@ -0,0 +1,13 @@
+//go:build go1.21
+
+package irpc
+
+import "log/slog"
+
+// *slog.Logger的方法和Logger相同，可以直接使用
+var _ Logger = (*slog.Logger)(nil)
+
+// 使用h输出日志，例如slog.NewJSONHandler
+func NewSlogLogger(h slog.Handler) Logger {
+	return slog.New(h)
+}
@@ -0,0 +1,311 @@
+// metrics 只用标准库实现计数器、仪表盘和直方图，并按Prometheus的文本格式导出
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Prometheus文本格式的Content-Type
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// 默认的直方图分桶，单位是秒，和Prometheus客户端库相同
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// 一组指标，按注册顺序导出，可以直接作为http.Handler挂到/metrics
+type Registry struct {
+	mu      sync.Mutex
+	metrics []*family
+	names   map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+// 一个指标名下按标签值区分的所有序列
+type family struct {
+	name, help, typ string
+	labels          []string
+	buckets         []float64
+	mu              sync.RWMutex
+	series          map[string]*series
+}
+
+type series struct {
+	values []string
+	// 计数器和仪表盘的值，直方图的和，float64的位
+	bits atomic.Uint64
+	// 直方图每个桶的计数，不累加，最后一个是+Inf
+	counts []atomic.Uint64
+	count  atomic.Uint64
+}
+
+// 重复的指标名、不合法的名字是编程错误，直接panic
+func (r *Registry) register(name, help, typ string, labels []string, buckets []float64) *family {
+	if !validName(name) {
+		panic("metrics: invalid metric name " + strconv.Quote(name))
+	}
+	for _, l := range labels {
+		if !validName(l) || l == "le" {
+			panic("metrics: invalid label name " + strconv.Quote(l))
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	f := &family{name: name, help: help, typ: typ, labels: labels, buckets: buckets, series: make(map[string]*series)}
+	r.metrics = append(r.metrics, f)
+	return f
+}
+
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		if c == '_' || c == ':' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && c >= '0' && c <= '9' {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+// 返回标签值对应的序列，不存在时创建，标签值的个数必须和标签名相同
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", f.name, len(f.labels), len(values)))
+	}
+	key := strings.Join(values, "\xff")
+	f.mu.RLock()
+	s := f.series[key]
+	f.mu.RUnlock()
+	if s != nil {
+		return s
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if s = f.series[key]; s == nil {
+		s = &series{values: append([]string(nil), values...)}
+		if f.buckets != nil {
+			s.counts = make([]atomic.Uint64, len(f.buckets)+1)
+		}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (s *series) add(v float64) {
+	for {
+		old := s.bits.Load()
+		if s.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (s *series) value() float64 {
+	return math.Float64frombits(s.bits.Load())
+}
+
+// 只增不减的计数器
+type CounterVec struct{ f *family }
+
+type Counter struct{ s *series }
+
+func (r *Registry) Counter(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{r.register(name, help, "counter", labels, nil)}
+}
+
+func (v *CounterVec) With(values ...string) Counter {
+	return Counter{v.f.with(values)}
+}
+
+func (c Counter) Inc() { c.s.add(1) }
+
+// v不能是负数
+func (c Counter) Add(v float64) {
+	if v < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.s.add(v)
+}
+
+func (c Counter) Value() float64 { return c.s.value() }
+
+// 可增可减的仪表盘，如正在处理的请求数
+type GaugeVec struct{ f *family }
+
+type Gauge struct{ s *series }
+
+func (r *Registry) Gauge(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{r.register(name, help, "gauge", labels, nil)}
+}
+
+func (v *GaugeVec) With(values ...string) Gauge {
+	return Gauge{v.f.with(values)}
+}
+
+func (g Gauge) Inc()          { g.s.add(1) }
+func (g Gauge) Dec()          { g.s.add(-1) }
+func (g Gauge) Add(v float64) { g.s.add(v) }
+func (g Gauge) Set(v float64) { g.s.bits.Store(math.Float64bits(v)) }
+
+func (g Gauge) Value() float64 { return g.s.value() }
+
+// 直方图，buckets是升序的桶上界，为空时使用DefBuckets
+type HistogramVec struct{ f *family }
+
+type Histogram struct {
+	s       *series
+	buckets []float64
+}
+
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	if !sort.Float64sAreSorted(buckets) {
+		panic("metrics: buckets of " + name + " are not sorted")
+	}
+	return &HistogramVec{r.register(name, help, "histogram", labels, append([]float64(nil), buckets...))}
+}
+
+func (v *HistogramVec) With(values ...string) Histogram {
+	return Histogram{v.f.with(values), v.f.buckets}
+}
+
+func (h Histogram) Observe(v float64) {
+	// 第一个上界不小于v的桶，都小于v时是+Inf
+	i := sort.SearchFloat64s(h.buckets, v)
+	h.s.counts[i].Add(1)
+	h.s.add(v)
+	h.s.count.Add(1)
+}
+
+func (h Histogram) Count() uint64 { return h.s.count.Load() }
+
+func (h Histogram) Sum() float64 { return h.s.value() }
+
+// 按文本格式写出所有指标，同一个指标的序列按标签值排序
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]*family(nil), r.metrics...)
+	r.mu.Unlock()
+	cw := &countWriter{w: bufio.NewWriter(w)}
+	for _, f := range families {
+		f.write(cw)
+	}
+	if cw.err == nil {
+		cw.err = cw.w.Flush()
+	}
+	return cw.n, cw.err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", ContentType)
+	_, _ = r.WriteTo(w)
+}
+
+func (f *family) write(w *countWriter) {
+	f.mu.RLock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.RUnlock()
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].values, "\xff") < strings.Join(all[j].values, "\xff")
+	})
+	w.printf("# HELP %s %s\n", f.name, escapeHelp(f.help))
+	w.printf("# TYPE %s %s\n", f.name, f.typ)
+	for _, s := range all {
+		if f.buckets == nil {
+			w.printf("%s%s %s\n", f.name, f.labelText(s.values, ""), formatFloat(s.value()))
+			continue
+		}
+		// 桶的计数在导出时累加
+		var cumulative uint64
+		for i := range s.counts {
+			cumulative += s.counts[i].Load()
+			le := math.Inf(1)
+			if i < len(f.buckets) {
+				le = f.buckets[i]
+			}
+			w.printf("%s_bucket%s %d\n", f.name, f.labelText(s.values, formatFloat(le)), cumulative)
+		}
+		w.printf("%s_sum%s %s\n", f.name, f.labelText(s.values, ""), formatFloat(s.value()))
+		w.printf("%s_count%s %d\n", f.name, f.labelText(s.values, ""), s.count.Load())
+	}
+}
+
+// le不为空时加上直方图桶的le标签
+func (f *family) labelText(values []string, le string) string {
+	if len(values) == 0 && le == "" {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "%s=\"%s\"", f.labels[i], escapeLabel(v))
+	}
+	if le != "" {
+		if len(values) > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, "le=\"%s\"", le)
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// 记录写出的字节数和第一个错误
+type countWriter struct {
+	w   *bufio.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) printf(format string, a ...interface{}) {
+	if w.err != nil {
+		return
+	}
+	n, err := fmt.Fprintf(w.w, format, a...)
+	w.n += int64(n)
+	w.err = err
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	calls := r.Counter("calls_total", "Calls.\nSecond line.", "method")
+	calls.With(`Arith."Mul"`).Inc()
+	calls.With("Arith.Add").Add(2)
+	r.Gauge("open", "Open connections.").With().Set(3)
+	latency := r.Histogram("latency_seconds", "Latency.", []float64{0.1, 1}, "method")
+	latency.With("Arith.Add").Observe(0.05)
+	latency.With("Arith.Add").Observe(0.5)
+	latency.With("Arith.Add").Observe(2)
+
+	var b strings.Builder
+	if _, err := r.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP calls_total Calls.\nSecond line.
+# TYPE calls_total counter
+calls_total{method="Arith.\"Mul\""} 1
+calls_total{method="Arith.Add"} 2
+# HELP open Open connections.
+# TYPE open gauge
+open 3
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{method="Arith.Add",le="0.1"} 1
+latency_seconds_bucket{method="Arith.Add",le="1"} 2
+latency_seconds_bucket{method="Arith.Add",le="+Inf"} 3
+latency_seconds_sum{method="Arith.Add"} 2.55
+latency_seconds_count{method="Arith.Add"} 3
+`
+	if b.String() != want {
+		t.Fatalf("got\n%s\nwant\n%s", b.String(), want)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if rec.Header().Get("Content-Type") != ContentType || rec.Body.String() != want {
+		t.Fatalf("got %q\n%s", rec.Header().Get("Content-Type"), rec.Body.String())
+	}
+}
+
+func TestRegistry_Panics(t *testing.T) {
+	mustPanic := func(name string, f func()) {
+		t.Helper()
+		defer func() {
+			if recover() == nil {
+				t.Fatalf("%s: expect a panic", name)
+			}
+		}()
+		f()
+	}
+	r := NewRegistry()
+	r.Counter("c", "")
+	mustPanic("duplicate", func() { r.Counter("c", "") })
+	mustPanic("bad name", func() { r.Gauge("1c", "") })
+	mustPanic("le label", func() { r.Histogram("h", "", nil, "le") })
+	mustPanic("label values", func() { r.Counter("d", "", "method").With() })
+	mustPanic("decrease", func() { r.Counter("e", "").With().Add(-1) })
+}
+
+func TestRPCMetrics_Nil(t *testing.T) {
+	var m *RPCMetrics
+	m.Start("Arith.Add")(0)
+	if m.Conn(nil) != nil {
+		t.Fatal("nil metrics should not wrap the connection")
+	}
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"net"
+	"sync/atomic"
+	"time"
+	"tinyRPCFramwork/irpc"
+)
+
+// 服务端或者客户端的RPC指标，通过Server.SetMetrics或者Option.Metrics使用
+// 方法都可以在nil上调用，此时不记录
+type RPCMetrics struct {
+	// 结束的请求数，标签是method和code
+	Requests *CounterVec
+	// 请求的耗时，标签是method
+	Latency *HistogramVec
+	// 正在处理的请求数，标签是method
+	InFlight *GaugeVec
+	// 连接上收到和发出的字节数，包括握手
+	BytesIn  *CounterVec
+	BytesOut *CounterVec
+	// 当前的连接数和建立过的连接总数
+	Connections      *GaugeVec
+	ConnectionsTotal *CounterVec
+}
+
+// 指标名以diyrpc_server_开头
+func NewServerMetrics(r *Registry) *RPCMetrics {
+	return newRPCMetrics(r, "diyrpc_server_", "handled by the server")
+}
+
+// 指标名以diyrpc_client_开头
+func NewClientMetrics(r *Registry) *RPCMetrics {
+	return newRPCMetrics(r, "diyrpc_client_", "sent by the client")
+}
+
+func newRPCMetrics(r *Registry, prefix, who string) *RPCMetrics {
+	return &RPCMetrics{
+		Requests:         r.Counter(prefix+"requests_total", "Total number of RPCs "+who+", by method and status code.", "method", "code"),
+		Latency:          r.Histogram(prefix+"request_duration_seconds", "Latency of RPCs "+who+".", DefBuckets, "method"),
+		InFlight:         r.Gauge(prefix+"requests_in_flight", "Number of RPCs currently "+who+".", "method"),
+		BytesIn:          r.Counter(prefix+"received_bytes_total", "Total bytes read from connections."),
+		BytesOut:         r.Counter(prefix+"sent_bytes_total", "Total bytes written to connections."),
+		Connections:      r.Gauge(prefix+"connections", "Number of open connections."),
+		ConnectionsTotal: r.Counter(prefix+"connections_total", "Total number of connections opened."),
+	}
+}
+
+// 开始一个请求，返回请求结束时调用的函数，多次调用只记录第一次
+func (m *RPCMetrics) Start(method string) func(code irpc.Code) {
+	if m == nil {
+		return func(irpc.Code) {}
+	}
+	inFlight := m.InFlight.With(method)
+	inFlight.Inc()
+	start := time.Now()
+	var finished atomic.Bool
+	return func(code irpc.Code) {
+		if !finished.CompareAndSwap(false, true) {
+			return
+		}
+		inFlight.Dec()
+		m.Requests.With(method, code.String()).Inc()
+		m.Latency.With(method).Observe(time.Since(start).Seconds())
+	}
+}
+
+// 返回记录字节数的连接，连接关闭时连接数减一
+func (m *RPCMetrics) Conn(conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+	m.Connections.With().Inc()
+	m.ConnectionsTotal.With().Inc()
+	return &countingConn{Conn: conn, in: m.BytesIn.With(), out: m.BytesOut.With(), open: m.Connections.With()}
+}
+
+type countingConn struct {
+	net.Conn
+	in, out Counter
+	open    Gauge
+	closed  atomic.Bool
+}
+
+func (c *countingConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		c.in.Add(float64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	if n > 0 {
+		c.out.Add(float64(n))
+	}
+	return n, err
+}
+
+func (c *countingConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.open.Dec()
+	}
+	return c.Conn.Close()
+}
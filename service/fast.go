@@ -0,0 +1,128 @@
+package service
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// 快速路径
+// 对于签名为 func (t *T) M([ctx context.Context,] args A, reply *R) error 的方法，
+// 如果(A, R)注册过，注册方法时把绑定了接收者的方法值断言成带类型的函数，调用时不经过反射，
+// 参数和reply从按类型共享的sync.Pool中取，避免每次调用都通过reflect.New分配
+//
+// 使用快速路径的方法不能在返回后继续持有args或reply，它们会被下一次调用复用
+type fastPath struct {
+	bind    func(method interface{}, hasCtx bool) invoker
+	args    sync.Pool
+	replies sync.Pool
+	// 放回池中前清零，gob不会写零值字段，复用前必须清零
+	reset func(argp, reply interface{})
+}
+
+// argp是指向参数的指针
+type invoker func(ctx context.Context, argp, reply interface{}) error
+
+type fastKey struct {
+	arg, reply reflect.Type
+}
+
+var (
+	fastMu    sync.RWMutex
+	fastPaths = make(map[fastKey]*fastPath)
+)
+
+// 为参数类型A、reply类型*R的方法注册快速路径，
+// 只影响之后注册的服务，通常在init中调用
+func RegisterFastPath[A, R any]() {
+	fp := &fastPath{
+		bind: func(method interface{}, hasCtx bool) invoker {
+			if hasCtx {
+				f, ok := method.(func(context.Context, A, *R) error)
+				if !ok {
+					return nil
+				}
+				return func(ctx context.Context, argp, reply interface{}) error {
+					return f(ctx, *argp.(*A), reply.(*R))
+				}
+			}
+			f, ok := method.(func(A, *R) error)
+			if !ok {
+				return nil
+			}
+			return func(_ context.Context, argp, reply interface{}) error {
+				return f(*argp.(*A), reply.(*R))
+			}
+		},
+		reset: func(argp, reply interface{}) {
+			var a A
+			var r R
+			*argp.(*A) = a
+			*reply.(*R) = r
+		},
+	}
+	fp.args.New = func() interface{} { return new(A) }
+	fp.replies.New = func() interface{} { return new(R) }
+	fastMu.Lock()
+	defer fastMu.Unlock()
+	fastPaths[fastKey{arg: typeOf[A](), reply: typeOf[*R]()}] = fp
+}
+
+// 常见的签名
+func init() {
+	RegisterFastPath[int, int]()
+	RegisterFastPath[int64, int64]()
+	RegisterFastPath[uint64, uint64]()
+	RegisterFastPath[float64, float64]()
+	RegisterFastPath[bool, bool]()
+	RegisterFastPath[string, string]()
+	RegisterFastPath[[]byte, []byte]()
+	RegisterFastPath[string, int]()
+	RegisterFastPath[int, string]()
+}
+
+// 注册方法时查找快速路径，接收者不是指针或者reply是map时不使用
+// map类型的reply需要NewReply创建好的map，清零后方法无法直接写入
+func (mt *MethodType) bindFast(rcvr reflect.Value) {
+	if mt.Streaming != Unary || rcvr.Kind() != reflect.Ptr || mt.ReplyType.Elem().Kind() == reflect.Map {
+		return
+	}
+	fastMu.RLock()
+	fp := fastPaths[fastKey{arg: mt.ArgType, reply: mt.ReplyType}]
+	fastMu.RUnlock()
+	if fp == nil {
+		return
+	}
+	// 方法值的类型由ArgType和ReplyType决定，断言不会失败，失败时退回反射调用
+	invoke := fp.bind(rcvr.Method(mt.Method.Index).Interface(), mt.HasContext)
+	if invoke == nil {
+		return
+	}
+	mt.fast = fp
+	mt.invoke = invoke
+}
+
+// 方法是否使用快速路径
+func (mt *MethodType) Fast() bool {
+	return mt.fast != nil
+}
+
+// 快速路径中从池中取参数和reply，argp是指向参数的指针，
+// 用完后通过Free放回池中
+func (mt *MethodType) NewArgs() (argp, reply interface{}) {
+	return mt.fast.args.Get(), mt.fast.replies.Get()
+}
+
+// 把参数和reply放回池中，之后不能再使用它们
+func (mt *MethodType) Free(argp, reply interface{}) {
+	mt.fast.reset(argp, reply)
+	mt.fast.args.Put(argp)
+	mt.fast.replies.Put(reply)
+}
+
+// 通过快速路径调用，参数来自NewArgs
+func (s *Service) CallFast(ctx context.Context, mt *MethodType, argp, reply interface{}) error {
+	atomic.AddUint64(&mt.numCalls, 1)
+	return mt.invoke(ctx, argp, reply)
+}
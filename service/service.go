@@ -1,8 +1,9 @@
 package service
 
 import (
+	"context"
+	"fmt"
 	"go/ast"
-	"log"
 	"reflect"
 	"sync/atomic"
 )
@@ -12,9 +13,21 @@ type MethodType struct {
 	Method    reflect.Method
 	ArgType   reflect.Type
 	ReplyType reflect.Type
-	numCalls  uint64
+	// 方法的第一个参数是否是context.Context
+	HasContext bool
+	// 流方法的ArgType是客户端每条消息的类型，ReplyType是服务端每条消息的类型，
+	// 客户端流方法的ReplyType仍然是最后返回的reply的类型
+	Streaming StreamKind
+	// 流参数的类型，如Stream[ReplyType]
+	streamType reflect.Type
+	numCalls   uint64
+	// 快速路径，见fast.go
+	fast   *fastPath
+	invoke invoker
 }
 
+var typeOfContext = reflect.TypeOf((*context.Context)(nil)).Elem()
+
 func (mt *MethodType) NumCalls() uint64 {
 	return atomic.LoadUint64(&mt.numCalls)
 }
@@ -45,19 +58,26 @@ type Service struct {
 	Method map[string]*MethodType
 }
 
-func NewService(rcvr interface{}) *Service {
+// 类型名不是公开的名字时返回错误
+func NewService(rcvr interface{}) (*Service, error) {
 	// main中传过来的rcvr是&foo
 	// 但是程序在运行时并不知道rcvr是什么
 	// 因为是一个空接口，可能接收到任何值
 	// 因此需要反射得到它的值和类型还有它的方法
+	name := reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	// 判断rcvr的名字是否是公开的（首字母大写）
+	if !ast.IsExported(name) {
+		return nil, fmt.Errorf("rpc server: %s is not a valid service name", name)
+	}
+	return NewServiceName(name, rcvr), nil
+}
+
+// 使用指定的服务名，rcvr的类型可以不公开，比如生成代码中的适配器
+func NewServiceName(name string, rcvr interface{}) *Service {
 	s := new(Service)
 	s.rcvr = reflect.ValueOf(rcvr)
-	s.Name = reflect.Indirect(s.rcvr).Type().Name()
+	s.Name = name
 	s.typ = reflect.TypeOf(rcvr)
-	// 判断rcvr的名字是否是公开的（首字母大写）
-	if !ast.IsExported(s.Name) {
-		log.Fatalf("rpc server: %s is not a valid service name", s.Name)
-	}
 	s.registerMethods()
 	return s
 }
@@ -72,7 +92,14 @@ func (s *Service) registerMethods() {
 		// 判断方法的入参数量和出参数量是否符合rpc调用方法
 		// 如果不符合，就跳过
 		// 过滤掉不符合条件的方法
-		if mType.NumIn() != 3 || mType.NumOut() != 1 {
+		// 方法可以是 func (t *T) M(args, reply) error
+		// 也可以是 func (t *T) M(ctx context.Context, args, reply) error
+		// 流方法的参数见stream.go
+		argIndex := 1
+		if mType.NumIn() > 1 && mType.In(1) == typeOfContext {
+			argIndex = 2
+		}
+		if numParams := mType.NumIn() - argIndex; numParams < 1 || numParams > 2 || mType.NumOut() != 1 {
 			continue
 		}
 		// 判断方法的返回值是否是error类型
@@ -80,31 +107,81 @@ func (s *Service) registerMethods() {
 		if mType.Out(0) != reflect.TypeOf((*error)(nil)).Elem() {
 			continue
 		}
-		// 获取函数类型mType的第2个和第3个参数的类型
-		argType, replyType := mType.In(1), mType.In(2)
-		if !isExportedOrBuildinType(argType) || !isExportedOrBuildinType(replyType) {
+		mt := &MethodType{
+			Method:     method,
+			HasContext: argIndex == 2,
+		}
+		if !mt.parseParams(mType, argIndex) {
 			continue
 		}
+		mt.bindFast(s.rcvr)
 		// 注册方法
-		s.Method[method.Name] = &MethodType{
-			Method:    method,
-			ArgType:   argType,
-			ReplyType: replyType,
+		s.Method[method.Name] = mt
+	}
+}
+
+// 根据参数确定ArgType、ReplyType和流类型，参数不符合要求时返回false
+func (mt *MethodType) parseParams(mType reflect.Type, argIndex int) bool {
+	if mType.NumIn()-argIndex == 1 {
+		// 只有双向流方法只有一个参数
+		param := mType.In(argIndex)
+		if !isStreamParam(param) || streamParamOf(param).streamKind() != BidiStreaming {
+			return false
+		}
+		mt.streamType = param
+	} else {
+		// 获取函数类型mType的args和reply参数的类型
+		argType, replyType := mType.In(argIndex), mType.In(argIndex+1)
+		switch {
+		case !isStreamParam(argType) && !isStreamParam(replyType):
+			mt.ArgType, mt.ReplyType = argType, replyType
+		case isStreamParam(replyType) && streamParamOf(replyType).streamKind() == ServerStreaming:
+			mt.ArgType, mt.streamType = argType, replyType
+		case isStreamParam(argType) && streamParamOf(argType).streamKind() == ClientStreaming:
+			mt.streamType, mt.ReplyType = argType, replyType
+		default:
+			return false
+		}
+	}
+	if mt.streamType != nil {
+		param := streamParamOf(mt.streamType)
+		mt.Streaming = param.streamKind()
+		recv, send := param.msgTypes()
+		if recv != nil {
+			mt.ArgType = recv
+		}
+		if send != nil {
+			mt.ReplyType = send
 		}
-		log.Printf("[rpc server] register %s.%s\n", s.Name, method.Name)
 	}
+	return isExportedOrBuildinType(mt.ArgType) && isExportedOrBuildinType(mt.ReplyType)
 }
+
 func isExportedOrBuildinType(t reflect.Type) bool {
 	return ast.IsExported(t.Name()) || t.PkgPath() == ""
 }
 
 func (s *Service) Call(mt *MethodType, argv, replyv reflect.Value) error {
+	return s.CallContext(context.Background(), mt, argv, replyv)
+}
+
+// 带ctx调用，方法的第一个参数是context.Context时把ctx传给它
+func (s *Service) CallContext(ctx context.Context, mt *MethodType, argv, replyv reflect.Value) error {
+	return s.call(ctx, mt, argv, replyv)
+}
+
+func (s *Service) call(ctx context.Context, mt *MethodType, params ...reflect.Value) error {
 	// 被调用，调用次数+1
 	atomic.AddUint64(&mt.numCalls, 1)
 	// 获取到方法的函数名
 	f := mt.Method.Func
 	// 调用函数f
-	returnV := f.Call([]reflect.Value{s.rcvr, argv, replyv})
+	in := []reflect.Value{s.rcvr}
+	if mt.HasContext {
+		in = append(in, reflect.ValueOf(ctx))
+	}
+	in = append(in, params...)
+	returnV := f.Call(in)
 	if errInter := returnV[0].Interface(); errInter != nil {
 		return errInter.(error)
 	}
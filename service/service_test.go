@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"testing"
@@ -14,6 +15,16 @@ func (f Foo) Sum(args Args, reply *int) error {
 	return nil
 }
 
+type FooCtx int
+
+func (f FooCtx) SumContext(ctx context.Context, args Args, reply *int) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	*reply = args.Num2 + args.Num1
+	return nil
+}
+
 func (f Foo) sum(args Args, reply *int) error {
 	*reply = args.Num1 + args.Num2
 	return nil
@@ -25,14 +36,14 @@ func _assert(condition bool, msg string, v ...interface{}) {
 }
 func TestNewService(t *testing.T) {
 	var foo Foo
-	s := NewService(&foo)
+	s := mustNewService(&foo)
 	_assert(len(s.Method) == 1, "wrong service Method,expect 1 but got %d", len(s.Method))
 	mType := s.Method["Sum"]
 	_assert(mType != nil, "wrong Method,Sum shouldn't nil")
 }
 func TestMethodType_Call(t *testing.T) {
 	var foo Foo
-	s := NewService(&foo)
+	s := mustNewService(&foo)
 	mType := s.Method["Sum"]
 
 	argv := mType.NewArgv()
@@ -41,3 +52,126 @@ func TestMethodType_Call(t *testing.T) {
 	err := s.Call(mType, argv, replyv)
 	_assert(err == nil && *replyv.Interface().(*int) == 4 && mType.NumCalls() == 1, "failed to call Foo.Sum")
 }
+
+func TestService_CallContext(t *testing.T) {
+	var foo FooCtx
+	s := mustNewService(&foo)
+	mType := s.Method["SumContext"]
+	_assert(mType != nil && mType.HasContext, "SumContext should take a context")
+
+	argv := mType.NewArgv()
+	replyv := mType.NewReply()
+	argv.Set(reflect.ValueOf(Args{Num1: 1, Num2: 3}))
+	err := s.CallContext(context.Background(), mType, argv, replyv)
+	_assert(err == nil && *replyv.Interface().(*int) == 4, "failed to call Foo.SumContext")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = s.CallContext(ctx, mType, argv, replyv)
+	_assert(err == context.Canceled, "expect the method to see the canceled ctx")
+}
+
+type Calc struct{}
+
+func (c *Calc) Double(args int, reply *int) error {
+	*reply = args * 2
+	return nil
+}
+
+func (c *Calc) Concat(ctx context.Context, args string, reply *string) error {
+	*reply = args + args
+	return nil
+}
+
+func (c *Calc) Add(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func TestService_CallFast(t *testing.T) {
+	s := mustNewService(new(Calc))
+	double := s.Method["Double"]
+	_assert(double.Fast(), "Double should use the fast path")
+	argp, reply := double.NewArgs()
+	*argp.(*int) = 21
+	err := s.CallFast(context.Background(), double, argp, reply)
+	_assert(err == nil && *reply.(*int) == 42 && double.NumCalls() == 1, "failed to call Calc.Double")
+	double.Free(argp, reply)
+
+	concat := s.Method["Concat"]
+	_assert(concat.Fast(), "Concat should use the fast path")
+	argp, reply = concat.NewArgs()
+	*argp.(*string) = "ab"
+	err = s.CallFast(context.Background(), concat, argp, reply)
+	_assert(err == nil && *reply.(*string) == "abab", "failed to call Calc.Concat")
+
+	_assert(!s.Method["Add"].Fast(), "Add should not use the fast path before registering")
+	// 注册表是全局的，测试结束后恢复，避免影响其它测试
+	fastMu.Lock()
+	saved := make(map[fastKey]*fastPath, len(fastPaths))
+	for k, v := range fastPaths {
+		saved[k] = v
+	}
+	fastMu.Unlock()
+	defer func() {
+		fastMu.Lock()
+		fastPaths = saved
+		fastMu.Unlock()
+	}()
+	RegisterFastPath[Args, int]()
+	s = mustNewService(new(Calc))
+	add := s.Method["Add"]
+	_assert(add.Fast(), "Add should use the fast path after registering")
+	argp, reply = add.NewArgs()
+	*argp.(*Args) = Args{Num1: 1, Num2: 2}
+	err = s.CallFast(context.Background(), add, argp, reply)
+	_assert(err == nil && *reply.(*int) == 3, "failed to call Calc.Add")
+	add.Free(argp, reply)
+	argp, _ = add.NewArgs()
+	_assert(*argp.(*Args) == Args{}, "pooled args should be reset")
+
+	// 接收者不是指针时不能使用快速路径
+	var foo Foo
+	_assert(!mustNewService(foo).Method["Sum"].Fast(), "value receiver should not use the fast path")
+}
+
+func BenchmarkCall_Reflect(b *testing.B) {
+	s := mustNewService(new(Calc))
+	mt := s.Method["Double"]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		argv, replyv := mt.NewArgv(), mt.NewReply()
+		argv.SetInt(int64(i))
+		_ = s.Call(mt, argv, replyv)
+	}
+}
+
+func BenchmarkCall_Fast(b *testing.B) {
+	s := mustNewService(new(Calc))
+	mt := s.Method["Double"]
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		argp, reply := mt.NewArgs()
+		*argp.(*int) = i
+		_ = s.CallFast(context.Background(), mt, argp, reply)
+		mt.Free(argp, reply)
+	}
+}
+
+func mustNewService(rcvr interface{}) *Service {
+	s, err := NewService(rcvr)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+type unexported struct{}
+
+func (u *unexported) Sum(args Args, reply *int) error { return nil }
+
+func TestNewService_Unexported(t *testing.T) {
+	if _, err := NewService(new(unexported)); err == nil {
+		t.Fatal("expect an error for an unexported service name")
+	}
+}
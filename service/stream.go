@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// 方法的流类型
+type StreamKind int
+
+const (
+	// 一个请求一个响应
+	Unary StreamKind = iota
+	// 一个请求，服务端返回多条消息
+	ServerStreaming
+	// 客户端发送多条消息，服务端返回一个响应
+	ClientStreaming
+	// 双方都可以发送多条消息
+	BidiStreaming
+)
+
+func (k StreamKind) String() string {
+	switch k {
+	case Unary:
+		return "unary"
+	case ServerStreaming:
+		return "server-streaming"
+	case ClientStreaming:
+		return "client-streaming"
+	case BidiStreaming:
+		return "bidi-streaming"
+	}
+	return fmt.Sprintf("StreamKind(%d)", int(k))
+}
+
+// 流的底层实现，由服务端提供
+type StreamConn interface {
+	Context() context.Context
+	// 发送一条消息，流控窗口用完时阻塞，直到对方确认或者ctx结束
+	SendMsg(msg interface{}) error
+	// 接收一条消息，返回指向消息的指针，对方关闭发送时返回io.EOF
+	RecvMsg() (interface{}, error)
+}
+
+// 服务端流，方法签名为
+// func (t *T) M(args, stream service.Stream[Reply]) error
+// 方法通过Send向客户端发送多条消息，方法返回时流结束，
+// 返回的错误会作为流的错误交给客户端
+type Stream[T any] struct {
+	conn StreamConn
+}
+
+func (s Stream[T]) Send(msg T) error {
+	return s.conn.SendMsg(msg)
+}
+
+// 客户端取消或者超时时结束
+func (s Stream[T]) Context() context.Context {
+	return s.conn.Context()
+}
+
+func (Stream[T]) streamKind() StreamKind {
+	return ServerStreaming
+}
+
+func (Stream[T]) msgTypes() (recv, send reflect.Type) {
+	return nil, typeOf[T]()
+}
+
+func (Stream[T]) bind(conn StreamConn) interface{} {
+	return Stream[T]{conn: conn}
+}
+
+// 客户端流，方法签名为
+// func (t *T) M(stream service.ClientStream[Args], reply *Reply) error
+// 方法通过Recv接收客户端的消息，客户端关闭发送后Recv返回io.EOF
+type ClientStream[T any] struct {
+	conn StreamConn
+}
+
+func (s ClientStream[T]) Recv() (T, error) {
+	return recv[T](s.conn)
+}
+
+func (s ClientStream[T]) Context() context.Context {
+	return s.conn.Context()
+}
+
+func (ClientStream[T]) streamKind() StreamKind {
+	return ClientStreaming
+}
+
+func (ClientStream[T]) msgTypes() (recv, send reflect.Type) {
+	return typeOf[T](), nil
+}
+
+func (ClientStream[T]) bind(conn StreamConn) interface{} {
+	return ClientStream[T]{conn: conn}
+}
+
+// 双向流，方法签名为
+// func (t *T) M(stream service.BidiStream[Args, Reply]) error
+type BidiStream[Req, Reply any] struct {
+	conn StreamConn
+}
+
+func (s BidiStream[Req, Reply]) Recv() (Req, error) {
+	return recv[Req](s.conn)
+}
+
+func (s BidiStream[Req, Reply]) Send(msg Reply) error {
+	return s.conn.SendMsg(msg)
+}
+
+func (s BidiStream[Req, Reply]) Context() context.Context {
+	return s.conn.Context()
+}
+
+func (BidiStream[Req, Reply]) streamKind() StreamKind {
+	return BidiStreaming
+}
+
+func (BidiStream[Req, Reply]) msgTypes() (recv, send reflect.Type) {
+	return typeOf[Req](), typeOf[Reply]()
+}
+
+func (BidiStream[Req, Reply]) bind(conn StreamConn) interface{} {
+	return BidiStream[Req, Reply]{conn: conn}
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func recv[T any](conn StreamConn) (T, error) {
+	var zero T
+	msg, err := conn.RecvMsg()
+	if err != nil {
+		return zero, err
+	}
+	return *msg.(*T), nil
+}
+
+// 所有流参数类型都实现了这个接口，注册方法时用它识别流参数
+type streamParam interface {
+	streamKind() StreamKind
+	msgTypes() (recv, send reflect.Type)
+	bind(conn StreamConn) interface{}
+}
+
+var typeOfStreamParam = reflect.TypeOf((*streamParam)(nil)).Elem()
+
+func isStreamParam(t reflect.Type) bool {
+	return t.Implements(typeOfStreamParam)
+}
+
+func streamParamOf(t reflect.Type) streamParam {
+	return reflect.Zero(t).Interface().(streamParam)
+}
+
+// 调用流方法，conn负责和客户端收发消息
+// 服务端流方法使用argv，客户端流方法使用replyv，双向流方法两个都不使用
+func (s *Service) CallStream(ctx context.Context, mt *MethodType, argv, replyv reflect.Value, conn StreamConn) error {
+	param := reflect.ValueOf(streamParamOf(mt.streamType).bind(conn))
+	switch mt.Streaming {
+	case ServerStreaming:
+		return s.call(ctx, mt, argv, param)
+	case ClientStreaming:
+		return s.call(ctx, mt, param, replyv)
+	default:
+		return s.call(ctx, mt, param)
+	}
+}
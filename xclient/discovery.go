@@ -0,0 +1,88 @@
+package xclient
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// 选择服务实例的方式
+type SelectMode int
+
+const (
+	RandomSelect SelectMode = iota
+	RoundRobinSelect
+)
+
+// 服务发现，提供可用的服务实例地址
+type Discovery interface {
+	// 从注册中心更新服务列表
+	Refresh() error
+	// 手动更新服务列表
+	Update(servers []string) error
+	// 按照mode选择一个实例
+	Get(mode SelectMode) (string, error)
+	// 返回所有实例
+	GetAll() ([]string, error)
+}
+
+// 不需要注册中心，由用户手动维护服务列表的Discovery
+type MultiServersDiscovery struct {
+	r       *rand.Rand
+	mu      sync.RWMutex
+	servers []string
+	// 轮询时记录选到的位置
+	index int
+}
+
+var _ Discovery = (*MultiServersDiscovery)(nil)
+
+func NewMultiServersDiscovery(servers []string) *MultiServersDiscovery {
+	d := &MultiServersDiscovery{
+		servers: servers,
+		r:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	// 随机一个起点，避免所有客户端都从第一个实例开始轮询
+	d.index = d.r.Intn(math.MaxInt32)
+	return d
+}
+
+func (d *MultiServersDiscovery) Refresh() error {
+	return nil
+}
+
+func (d *MultiServersDiscovery) Update(servers []string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.servers = servers
+	return nil
+}
+
+func (d *MultiServersDiscovery) Get(mode SelectMode) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := len(d.servers)
+	if n == 0 {
+		return "", errors.New("[rpc discovery] no available servers")
+	}
+	switch mode {
+	case RandomSelect:
+		return d.servers[d.r.Intn(n)], nil
+	case RoundRobinSelect:
+		s := d.servers[d.index%n]
+		d.index = (d.index + 1) % n
+		return s, nil
+	default:
+		return "", errors.New("[rpc discovery] not supported select mode")
+	}
+}
+
+func (d *MultiServersDiscovery) GetAll() ([]string, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	servers := make([]string, len(d.servers))
+	copy(servers, d.servers)
+	return servers, nil
+}
@@ -0,0 +1,159 @@
+package xclient
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/irpc"
+)
+
+// 对冲请求的计数
+type HedgeStats struct {
+	// 发出的对冲请求数（不包括第一次请求）
+	Fired uint64
+	// 对冲请求先于第一次请求成功返回的次数
+	Won uint64
+}
+
+// 保存最近一段时间成功调用的延迟，用于计算p95
+type latencyWindow struct {
+	mu      sync.Mutex
+	samples []time.Duration
+	next    int
+}
+
+const (
+	latencyWindowSize = 128
+	// 样本数少于这个值时p95不可信
+	minLatencySamples = 20
+)
+
+func (w *latencyWindow) add(d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < latencyWindowSize {
+		w.samples = append(w.samples, d)
+		return
+	}
+	w.samples[w.next] = d
+	w.next = (w.next + 1) % latencyWindowSize
+}
+
+func (w *latencyWindow) p95() (time.Duration, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.samples) < minLatencySamples {
+		return 0, false
+	}
+	sorted := make([]time.Duration, len(w.samples))
+	copy(sorted, w.samples)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	return sorted[len(sorted)*95/100], true
+}
+
+func (xc *XClient) latency(serviceMethod string) *latencyWindow {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	w, ok := xc.latencies[serviceMethod]
+	if !ok {
+		w = new(latencyWindow)
+		xc.latencies[serviceMethod] = w
+	}
+	return w
+}
+
+func (xc *XClient) HedgeStats() HedgeStats {
+	return HedgeStats{
+		Fired: atomic.LoadUint64(&xc.hedgeFired),
+		Won:   atomic.LoadUint64(&xc.hedgeWon),
+	}
+}
+
+type hedgeResult struct {
+	attempt int
+	// 这次请求发出的时间
+	start time.Time
+	reply reflect.Value
+	err   error
+}
+
+// 对冲调用：先向一个实例发请求，超过delay还没有结果就向另一个实例再发一次，
+// 取最先成功的结果，返回前取消其余还在进行的请求。
+// 请求返回不可重试的错误时直接返回这个错误，不再发出新的请求
+func (xc *XClient) hedgedCall(ctx context.Context, serviceMethod string, policy *client.HedgingPolicy, args, reply interface{}) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	window := xc.latency(serviceMethod)
+	delay := policy.Delay
+	if policy.UseP95 {
+		if p95, ok := window.p95(); ok {
+			delay = p95
+		}
+	}
+	// 每个请求解码到自己的reply，避免并发写同一个reply
+	rt := reflect.TypeOf(reply)
+	if rt == nil || rt.Kind() != reflect.Ptr || reflect.ValueOf(reply).IsNil() {
+		return irpc.Errorf(irpc.CodeInvalidArgument, "[rpc xclient] hedged call needs a non-nil pointer reply, got %T", reply)
+	}
+	replyType := rt.Elem()
+	results := make(chan hedgeResult, policy.MaxAttempts)
+	tried := make(map[string]bool)
+	launch := func(attempt int) {
+		addr, err := xc.pick(tried)
+		if err == nil {
+			tried[addr] = true
+		}
+		replyv := reflect.New(replyType)
+		start := time.Now()
+		go func() {
+			if err == nil {
+				err = xc.callAddr(ctx, addr, serviceMethod, args, replyv.Interface())
+			}
+			results <- hedgeResult{attempt: attempt, start: start, reply: replyv, err: err}
+		}()
+	}
+
+	launch(0)
+	launched, inflight := 1, 1
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	var lastErr error
+	for inflight > 0 {
+		select {
+		case <-timer.C:
+			if launched < policy.MaxAttempts {
+				launch(launched)
+				launched++
+				inflight++
+				atomic.AddUint64(&xc.hedgeFired, 1)
+				timer.Reset(delay)
+			}
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				window.add(time.Since(r.start))
+				if r.attempt > 0 {
+					atomic.AddUint64(&xc.hedgeWon, 1)
+				}
+				reflect.ValueOf(reply).Elem().Set(r.reply.Elem())
+				return nil
+			}
+			if !policy.Retryable(r.err) {
+				return r.err
+			}
+			lastErr = r.err
+			// 所有请求都失败了，不用等定时器，直接发下一个
+			if inflight == 0 && launched < policy.MaxAttempts && ctx.Err() == nil {
+				launch(launched)
+				launched++
+				inflight++
+				atomic.AddUint64(&xc.hedgeFired, 1)
+			}
+		}
+	}
+	return lastErr
+}
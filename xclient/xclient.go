@@ -0,0 +1,177 @@
+package xclient
+
+import (
+	"context"
+	"sync"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+// 支持多个服务实例的客户端，通过Discovery选择实例，
+// 为每个实例缓存一个Client，重试时会优先选择还没有尝试过的实例
+type XClient struct {
+	d      Discovery
+	mode   SelectMode
+	opt    *diyrpc.Option
+	mu     sync.Mutex
+	config *client.ServiceConfig
+	// 实例地址到Client的映射
+	clients map[string]*client.Client
+	// 正在拨号的实例，同一个地址同时只拨一次
+	dialing map[string]*dialCall
+	// 每个方法最近的调用延迟，对冲请求用它计算p95
+	latencies  map[string]*latencyWindow
+	hedgeFired uint64
+	hedgeWon   uint64
+	// 每个实例一个熔断器，breakerConfig为空时不熔断
+	breakerConfig *client.BreakerConfig
+	breakers      map[string]*client.Breaker
+}
+
+func NewXClient(d Discovery, mode SelectMode, opt *diyrpc.Option) *XClient {
+	return &XClient{
+		d:         d,
+		mode:      mode,
+		opt:       opt,
+		clients:   make(map[string]*client.Client),
+		dialing:   make(map[string]*dialCall),
+		latencies: make(map[string]*latencyWindow),
+		breakers:  make(map[string]*client.Breaker),
+	}
+}
+
+// 设置按方法的调用配置，幂等的方法会按照其重试策略在不同实例间重试
+func (xc *XClient) SetServiceConfig(sc *client.ServiceConfig) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.config = sc
+}
+
+// 为每个实例开启熔断，熔断器打开的实例会被直接跳过
+func (xc *XClient) SetBreakerConfig(cfg *client.BreakerConfig) {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	xc.breakerConfig = cfg
+	xc.breakers = make(map[string]*client.Breaker)
+}
+
+// 返回addr的熔断器，没有开启熔断时返回nil
+func (xc *XClient) Breaker(addr string) *client.Breaker {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	if xc.breakerConfig == nil {
+		return nil
+	}
+	b, ok := xc.breakers[addr]
+	if !ok {
+		b = client.NewBreaker(addr, xc.breakerConfig)
+		xc.breakers[addr] = b
+	}
+	return b
+}
+
+func (xc *XClient) Close() error {
+	xc.mu.Lock()
+	defer xc.mu.Unlock()
+	for addr, c := range xc.clients {
+		_ = c.Close()
+		delete(xc.clients, addr)
+	}
+	return nil
+}
+
+// 一次正在进行的拨号，其他调用方等待done后使用它的结果
+type dialCall struct {
+	done chan struct{}
+	c    *client.Client
+	err  error
+}
+
+// 拨号最长需要ConnectionTimeout，在锁外进行，避免一个不可达的实例阻塞对其他实例的调用
+func (xc *XClient) dial(addr string) (*client.Client, error) {
+	xc.mu.Lock()
+	c, ok := xc.clients[addr]
+	if ok && c.IsAvailable() {
+		xc.mu.Unlock()
+		return c, nil
+	}
+	if ok {
+		// 断开的Client在锁外关闭
+		delete(xc.clients, addr)
+		defer func() { _ = c.Close() }()
+	}
+	if d, ok := xc.dialing[addr]; ok {
+		xc.mu.Unlock()
+		<-d.done
+		return d.c, d.err
+	}
+	d := &dialCall{done: make(chan struct{})}
+	xc.dialing[addr] = d
+	xc.mu.Unlock()
+
+	d.c, d.err = client.Dial("tcp", addr, xc.opt)
+	if d.err != nil {
+		d.err = irpc.Errorf(irpc.CodeUnavailable, "[rpc xclient] dial %s failed: %v", addr, d.err)
+	}
+	xc.mu.Lock()
+	delete(xc.dialing, addr)
+	if d.err == nil {
+		xc.clients[addr] = d.c
+	}
+	xc.mu.Unlock()
+	close(d.done)
+	return d.c, d.err
+}
+
+// 选择一个实例，尽量避开tried中已经尝试过的实例和熔断器打开的实例
+func (xc *XClient) pick(tried map[string]bool) (string, error) {
+	servers, err := xc.d.GetAll()
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < len(servers)*2; i++ {
+		addr, err := xc.d.Get(xc.mode)
+		if err != nil {
+			return "", err
+		}
+		if !tried[addr] && xc.Breaker(addr).Ready() {
+			return addr, nil
+		}
+	}
+	// 所有实例都尝试过了
+	return xc.d.Get(xc.mode)
+}
+
+func (xc *XClient) Call(ctx context.Context, serviceMethod string, args, reply interface{}) error {
+	xc.mu.Lock()
+	sc := xc.config
+	xc.mu.Unlock()
+	if mc := sc.Lookup(serviceMethod); mc != nil && mc.Idempotent && mc.Hedging != nil && mc.Hedging.MaxAttempts > 1 {
+		return xc.hedgedCall(ctx, serviceMethod, mc.Hedging, args, reply)
+	}
+	tried := make(map[string]bool)
+	return sc.Do(ctx, serviceMethod, func(attempt int) error {
+		addr, err := xc.pick(tried)
+		if err != nil {
+			return err
+		}
+		tried[addr] = true
+		return xc.callAddr(ctx, addr, serviceMethod, args, reply)
+	})
+}
+
+// 向addr上的实例发起一次调用，经过该实例的熔断器
+func (xc *XClient) callAddr(ctx context.Context, addr, serviceMethod string, args, reply interface{}) error {
+	done, err := xc.Breaker(addr).Allow(ctx)
+	if err != nil {
+		// 只是这个实例的熔断器打开了，转换成普通的Unavailable，重试时可以换一个实例
+		return irpc.Errorf(irpc.CodeUnavailable, "[rpc xclient] %s: %v", addr, err)
+	}
+	c, err := xc.dial(addr)
+	if err == nil {
+		err = c.Call(ctx, serviceMethod, args, reply)
+	}
+	done(err)
+	return err
+}
@@ -0,0 +1,201 @@
+package xclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"tinyRPCFramwork/client"
+	"tinyRPCFramwork/code"
+	"tinyRPCFramwork/diyrpc"
+	"tinyRPCFramwork/irpc"
+)
+
+func _assert(condition bool, msg string, v ...interface{}) {
+	if !condition {
+		panic(fmt.Sprintf("assertion failed:"+msg, v...))
+	}
+}
+
+type Foo int
+type Args struct{ Num1, Num2 int }
+
+func (f Foo) Sum(args Args, reply *int) error {
+	*reply = args.Num1 + args.Num2
+	return nil
+}
+
+func startServer() string {
+	var foo Foo
+	s := diyrpc.NewServer()
+	_ = s.Register(&foo)
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+// 返回一个没有服务监听的地址
+func deadAddr() string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := l.Addr().String()
+	_ = l.Close()
+	return addr
+}
+
+func TestXClient_CallRetry(t *testing.T) {
+	code.Init()
+	d := NewMultiServersDiscovery([]string{deadAddr(), startServer()})
+	xc := NewXClient(d, RoundRobinSelect, &diyrpc.Option{ConnectionTimeout: time.Second})
+	defer func() { _ = xc.Close() }()
+	xc.SetServiceConfig(&client.ServiceConfig{Methods: map[string]*client.MethodConfig{
+		"Foo.*": {Idempotent: true, Retry: &client.RetryPolicy{
+			MaxAttempts:    2,
+			InitialBackoff: time.Millisecond,
+			RetryableCodes: []irpc.Code{irpc.CodeUnavailable},
+		}},
+	}})
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "expect retry on the other instance, got %v", err)
+	}
+}
+
+type Sleeper struct{ delay time.Duration }
+
+func (s *Sleeper) Sleep(args int, reply *int) error {
+	time.Sleep(s.delay)
+	*reply = args
+	return nil
+}
+
+func startSleeper(delay time.Duration) string {
+	s := diyrpc.NewServer()
+	_ = s.Register(&Sleeper{delay: delay})
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go s.Accept(l)
+	return l.Addr().String()
+}
+
+func TestXClient_Hedging(t *testing.T) {
+	code.Init()
+	d := NewMultiServersDiscovery([]string{startSleeper(time.Second), startSleeper(0)})
+	xc := NewXClient(d, RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetServiceConfig(&client.ServiceConfig{Methods: map[string]*client.MethodConfig{
+		"Sleeper.Sleep": {Idempotent: true, Hedging: &client.HedgingPolicy{
+			MaxAttempts: 2,
+			Delay:       time.Millisecond * 50,
+		}},
+	}})
+	for i := 0; i < 4; i++ {
+		var reply int
+		start := time.Now()
+		err := xc.Call(context.Background(), "Sleeper.Sleep", i, &reply)
+		_assert(err == nil && reply == i, "hedged call failed: %v", err)
+		_assert(time.Since(start) < time.Millisecond*500, "expect the hedge to win over the slow instance")
+	}
+	stats := xc.HedgeStats()
+	_assert(stats.Fired >= 1 && stats.Won >= 1, "expect hedges to fire and win, got %+v", stats)
+	err := xc.Call(context.Background(), "Sleeper.Sleep", 1, nil)
+	_assert(irpc.CodeOf(err) == irpc.CodeInvalidArgument, "expect an error for a nil reply, got %v", err)
+}
+
+// 接受连接但从不回复，拨号会一直等到ConnectionTimeout
+func blackholeAddr(accepted *int32) string {
+	l, _ := net.Listen("tcp", "127.0.0.1:0")
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(accepted, 1)
+			defer func() { _ = conn.Close() }()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestXClient_DialOutsideLock(t *testing.T) {
+	code.Init()
+	var accepted int32
+	slow, healthy := blackholeAddr(&accepted), startServer()
+	d := NewMultiServersDiscovery([]string{slow, healthy})
+	xc := NewXClient(d, RoundRobinSelect, &diyrpc.Option{ConnectionTimeout: 500 * time.Millisecond})
+	defer func() { _ = xc.Close() }()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := xc.dial(slow)
+			_assert(irpc.CodeOf(err) == irpc.CodeUnavailable, "expect the dial to time out, got %v", err)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	var reply int
+	err := xc.callAddr(context.Background(), healthy, "Foo.Sum", Args{Num1: 1, Num2: 2}, &reply)
+	_assert(err == nil && reply == 3, "call to the healthy instance failed: %v", err)
+	_assert(time.Since(start) < 200*time.Millisecond, "call waited behind the slow dial for %s", time.Since(start))
+	wg.Wait()
+	_assert(atomic.LoadInt32(&accepted) == 1, "expect one dial to the slow instance, got %d", accepted)
+}
+
+// 熔断器打开的实例不会被选中，请求直接落到健康的实例上
+func TestXClient_PickSkipsOpenBreaker(t *testing.T) {
+	code.Init()
+	dead := deadAddr()
+	d := NewMultiServersDiscovery([]string{dead, startServer()})
+	xc := NewXClient(d, RoundRobinSelect, &diyrpc.Option{ConnectionTimeout: time.Second})
+	defer func() { _ = xc.Close() }()
+	xc.SetBreakerConfig(&client.BreakerConfig{ConsecutiveFailures: 1, OpenTimeout: time.Minute})
+	done, _ := xc.Breaker(dead).Allow(context.Background())
+	done(irpc.NewError(irpc.CodeUnavailable, "unavailable"))
+	_assert(xc.Breaker(dead).State() == client.StateOpen, "expect the breaker of %s to be open", dead)
+	for i := 0; i < 4; i++ {
+		var reply int
+		err := xc.Call(context.Background(), "Foo.Sum", Args{Num1: i, Num2: 1}, &reply)
+		_assert(err == nil && reply == i+1, "expect the open instance to be skipped, got %v", err)
+	}
+}
+
+type Rejecter struct{ calls int32 }
+
+func (r *Rejecter) Reject(args int, reply *int) error {
+	atomic.AddInt32(&r.calls, 1)
+	return irpc.NewError(irpc.CodeInvalidArgument, "bad argument")
+}
+
+// 不可重试的错误直接返回，不再发出新的对冲请求
+func TestXClient_HedgingFatalError(t *testing.T) {
+	code.Init()
+	r := new(Rejecter)
+	var addrs []string
+	for i := 0; i < 2; i++ {
+		s := diyrpc.NewServer()
+		_ = s.Register(r)
+		l, _ := net.Listen("tcp", "127.0.0.1:0")
+		defer func() { _ = l.Close() }()
+		go s.Accept(l)
+		addrs = append(addrs, l.Addr().String())
+	}
+	xc := NewXClient(NewMultiServersDiscovery(addrs), RoundRobinSelect, nil)
+	defer func() { _ = xc.Close() }()
+	xc.SetServiceConfig(&client.ServiceConfig{Methods: map[string]*client.MethodConfig{
+		"Rejecter.Reject": {Idempotent: true, Hedging: &client.HedgingPolicy{
+			MaxAttempts: 3,
+			Delay:       time.Second,
+		}},
+	}})
+	var reply int
+	err := xc.Call(context.Background(), "Rejecter.Reject", 1, &reply)
+	_assert(irpc.CodeOf(err) == irpc.CodeInvalidArgument, "expect InvalidArgument, got %v", err)
+	_assert(atomic.LoadInt32(&r.calls) == 1, "expect a single attempt, got %d", atomic.LoadInt32(&r.calls))
+	_assert(xc.HedgeStats().Fired == 0, "expect no hedges, got %+v", xc.HedgeStats())
+}